@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/debug/dwarf"
+)
+
+var valueDepth = flag.Int("value-depth", 3, "core, triage: levels of pointers to follow")
+var valueLen = flag.Int("value-len", 64, "core, triage: elements of collections and bytes of strings to print")
+var heapTop = flag.Int("top", 30, "core heap: types to list (0 for all)")
+
+// Core runs the core subcommand given by args.
+func (p *Process) Core(args []string) error {
+	if !p.Attached() {
+		return fmt.Errorf("--core or --pid is required")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("core subcommand is required")
+	}
+
+	switch args[0] {
+	case "var":
+		if len(args) < 2 {
+			return fmt.Errorf("variable name is required")
+		}
+		for _, name := range args[1:] {
+			if err := p.PrintVar(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "heap":
+		return p.PrintHeap()
+	case "stats":
+		return p.PrintRuntimeStats()
+	case "goroutines":
+		return p.PrintGoroutines()
+	case "locks":
+		return p.PrintLocks()
+	case "auxv":
+		return p.PrintAuxv()
+	case "redact":
+		return p.Redact(*dumpOutput)
+	case "validate":
+		return p.PrintCoreChecks()
+	case "maps":
+		p.PrintMappings()
+		return nil
+	}
+
+	return fmt.Errorf("unknown core subcommand %v", args[0])
+}
+
+// CheckCore warns about the core not matching the executable and tells
+// whether it matches.
+func (p *Process) CheckCore() bool {
+	checks := elf2.ValidateCore(p.efd, p.core, p.path)
+	if !elf2.Mismatch(checks) {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: core %v does not match executable %v, symbols and values are likely wrong:\n", p.corePath, p.path)
+	for _, c := range checks {
+		if c.Status == elf2.CheckMismatch {
+			fmt.Fprintf(os.Stderr, "  %v: executable %v, core %v\n", c.Name, c.Exe, c.Core)
+		}
+	}
+	return false
+}
+
+// PrintCoreChecks prints the checks of the core against the executable.
+func (p *Process) PrintCoreChecks() error {
+	if p.core == nil {
+		return fmt.Errorf("core validate needs --core")
+	}
+	checks := elf2.ValidateCore(p.efd, p.core, p.path)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Check", "Status", "Executable", "Core"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	for _, c := range checks {
+		table.Append([]string{c.Name, c.Status.String(), c.Exe, c.Core})
+	}
+	table.Render()
+
+	if elf2.Mismatch(checks) {
+		return fmt.Errorf("core %v does not match executable %v", p.corePath, p.path)
+	}
+	return nil
+}
+
+// PrintCoreObjects prints the executable and shared objects of the core
+// and where their files are found. It needs no executable.
+func PrintCoreObjects(path string, dirs []string) error {
+	core, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer core.Close()
+	objs, err := elf2.CoreObjects(core)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Address", "Name", "Build ID", "Status", "Path"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	var missing int
+	for _, o := range objs {
+		o.Find(*sysroot, dirs)
+		if o.Status != elf2.ObjectFound {
+			missing++
+		}
+		name, id := o.Name, o.GNUBuildID
+		if o.Main {
+			name += " (executable)"
+		}
+		if id == "" {
+			id = o.GoBuildID
+		}
+		table.Append([]string{fmt.Sprintf("0x%x", o.Start), name, id, o.Status.String(), o.Path})
+	}
+	table.Render()
+
+	if missing > 0 {
+		return fmt.Errorf("%d of %d objects are missing or mismatch", missing, len(objs))
+	}
+	return nil
+}
+
+// ValuePrinter returns the formatter of values in the process memory.
+func (p *Process) ValuePrinter() (*elf2.ValuePrinter, error) {
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return nil, err
+	}
+
+	vp := elf2.NewValuePrinter(r)
+	vp.MaxDepth, vp.MaxLen = *valueDepth, *valueLen
+
+	// dynamic types of interfaces are matched by DW_AT_go_runtime_type,
+	// the types without it by the names of DWARFNames
+	if d, err := p.DWARF(); err == nil {
+		if tr, err := p.TypeReader(); err == nil {
+			vp.TypeOf = func(addr uint64) (dwarf.Type, error) {
+				if p.rtypes == nil {
+					md, err := p.ModuleData()
+					if err != nil {
+						return nil, err
+					}
+					if p.rtypes, err = elf2.RuntimeTypes(d, md.Types); err != nil {
+						return nil, err
+					}
+				}
+				if off, ok := p.rtypes[addr]; ok {
+					return d.Type(off)
+				}
+				names := tr.DWARFNames(addr)
+				for _, name := range names {
+					if e, err := d.LookupEntry(name); err == nil {
+						return d.Type(e.Offset)
+					}
+				}
+				return nil, fmt.Errorf("DWARF entry for %q not found", names)
+			}
+		}
+	}
+
+	return vp, nil
+}
+
+// PrintVar prints the global variable by its DWARF type.
+func (p *Process) PrintVar(name string) error {
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	vp, err := p.ValuePrinter()
+	if err != nil {
+		return err
+	}
+
+	v, err := elf2.GlobalValue(vp.Reader(), d, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %s = %s\n", name, v.Type, vp.Format(v.Addr, v.Type))
+	return nil
+}
+
+// PrintHeap prints the census of the heap objects by type and size class.
+func (p *Process) PrintHeap() error {
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return err
+	}
+
+	var typeName func(uint64) string
+	if tr, err := p.TypeReader(); err == nil {
+		typeName = tr.TypeName
+	}
+
+	c, err := elf2.ReadHeapCensus(r, d, typeName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d objects, %d bytes\n\n", c.Objects, c.Bytes)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Count", "Avg size", "Bytes", "Type"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for i, ts := range c.Types {
+		if *heapTop > 0 && i == *heapTop {
+			table.Append([]string{"...", "", "", fmt.Sprintf("%d more types", len(c.Types)-i)})
+			break
+		}
+		table.Append([]string{
+			fmt.Sprint(ts.Count), fmt.Sprint(ts.Bytes / ts.Count), fmt.Sprint(ts.Bytes), ts.Name,
+		})
+	}
+	table.Render()
+	fmt.Println()
+
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Class", "Size", "Spans", "Objects", "Bytes"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, cs := range c.Classes {
+		table.Append([]string{
+			cs.Name, fmt.Sprint(cs.Size), fmt.Sprint(cs.Spans), fmt.Sprint(cs.Count), fmt.Sprint(cs.Bytes),
+		})
+	}
+	table.Render()
+
+	return nil
+}
+
+// PrintRuntimeStats prints the summary of the runtime memory, GC and
+// scheduler state.
+func (p *Process) PrintRuntimeStats() error {
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return err
+	}
+
+	s, err := elf2.ReadRuntimeStats(r, d)
+	if err != nil {
+		return err
+	}
+
+	lastGC := "never"
+	if s.LastGC != 0 {
+		lastGC = time.Unix(0, int64(s.LastGC)).UTC().Format(time.RFC3339Nano)
+	}
+	limit := "none"
+	if s.MemoryLimit > 0 && s.MemoryLimit != 1<<63-1 {
+		limit = byteSize(uint64(s.MemoryLimit))
+	}
+
+	var states []string
+	for name, n := range s.Goroutines {
+		states = append(states, fmt.Sprintf("%s=%d", name, n))
+	}
+	sort.Strings(states)
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.AppendBulk([][]string{
+		{"Heap in use", byteSize(s.HeapInUse)},
+		{"Heap live", byteSize(s.HeapLive)},
+		{"Heap marked", byteSize(s.HeapMarked)},
+		{"Heap goal", byteSize(s.HeapGoal)},
+		{"Heap released", byteSize(s.HeapReleased)},
+		{"Total alloc", byteSize(s.TotalAlloc)},
+		{"Stacks in use", byteSize(s.StacksInUse)},
+		{"GOGC", fmt.Sprint(s.GCPercent)},
+		{"GOMEMLIMIT", limit},
+		{"GC cycles", fmt.Sprintf("%d (%d forced)", s.NumGC, s.NumForcedGC)},
+		{"GC pause total", time.Duration(s.PauseTotal).String()},
+		{"Last GC", lastGC},
+		{"GOMAXPROCS", fmt.Sprint(s.GOMAXPROCS)},
+		{"Ps", fmt.Sprintf("%d (%d idle)", s.Ps, s.IdlePs)},
+		{"Ms", fmt.Sprintf("%d (%d idle, %d spinning)", s.Ms, s.IdleMs, s.SpinningMs)},
+		{"Gs", fmt.Sprintf("%d (%d live) %s", s.Gs, s.Live(), strings.Join(states, " "))},
+		{"Run queue", fmt.Sprint(s.RunQueue)},
+	})
+	table.Render()
+
+	return nil
+}
+
+func byteSize(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%d (%.1f %ciB)", n, float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// PrintAuxv prints the auxiliary vector of the process.
+func (p *Process) PrintAuxv() error {
+	auxv, err := p.Auxv()
+	if err != nil {
+		return err
+	}
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range auxv {
+		v := fmt.Sprintf("0x%x", a.Val)
+		if a.Tag == elf2.AT_EXECFN || a.Tag == elf2.AT_PLATFORM {
+			if s, err := r.CString(a.Val, 4096); err == nil {
+				v += fmt.Sprintf(" %q", s)
+			}
+		}
+		fmt.Printf("%-20s %s\n", a.Tag, v)
+	}
+
+	return nil
+}
+
+// PrintMappings prints the memory ranges of the process.
+func (p *Process) PrintMappings() {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Start", "End", "Flags", "Offset", "File"})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, m := range p.Memory().Mappings() {
+		table.Append([]string{
+			fmt.Sprintf("0x%x", m.Start), fmt.Sprintf("0x%x", m.End), m.Flags.String(), fmt.Sprintf("0x%x", m.Off), m.File,
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/debug/dwarf"
+)
+
+var dwarfKind = flag.String("kind", "any", "dwarf: entry kind to look up (any, func, var)")
+var dwarfRegex = flag.Bool("regex", false, "dwarf: match names by regular expression")
+var dwarfDepth = flag.Int("depth", -1, "dwarf: levels of children to print (-1 for all)")
+var jsonOutput = flag.Bool("json", false, "dwarf, triage, core goroutines, core locks: print as JSON")
+
+// DwarfEntry is a debug_info entry with resolved type and children.
+type DwarfEntry struct {
+	Offset   dwarf.Offset  `json:"offset"`
+	Tag      string        `json:"tag"`
+	Attrs    []DwarfAttr   `json:"attrs"`
+	Type     string        `json:"type,omitempty"`
+	Children []*DwarfEntry `json:"children,omitempty"`
+}
+
+type DwarfAttr struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// BrowseDWARF lists compile units or, given a name, regexp or offset,
+// prints the matching entries.
+func (p *Process) BrowseDWARF(arg string) error {
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+
+	if arg == "" {
+		return p.PrintCompileUnits(d)
+	}
+
+	var entries []*dwarf.Entry
+	if off, err := strconv.ParseUint(arg, 0, 32); err == nil {
+		r := d.Reader()
+		r.Seek(dwarf.Offset(off))
+		e, err := r.Next()
+		if err != nil || e == nil {
+			return fmt.Errorf("no entry at 0x%x: %v", off, err)
+		}
+		entries = append(entries, e)
+	} else if entries, err = lookupEntries(d, arg); err != nil {
+		return err
+	}
+
+	var res []*DwarfEntry
+	for _, e := range entries {
+		de, err := readEntry(d, e, *dwarfDepth)
+		if err != nil {
+			return err
+		}
+		res = append(res, de)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(res)
+	}
+
+	for _, de := range res {
+		printEntry(de, 0)
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func lookupEntries(d *dwarf.Data, arg string) ([]*dwarf.Entry, error) {
+	lookup := d.LookupEntry
+	switch *dwarfKind {
+	case "any":
+	case "func":
+		lookup = d.LookupFunction
+	case "var":
+		lookup = d.LookupVariable
+	default:
+		return nil, fmt.Errorf("unknown entry kind %v", *dwarfKind)
+	}
+
+	names := []string{arg}
+	if *dwarfRegex {
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		if names, err = d.LookupMatchingSymbols(re); err != nil {
+			return nil, err
+		}
+		sort.Strings(names)
+	}
+
+	var entries []*dwarf.Entry
+	for _, name := range names {
+		e, err := lookup(name)
+		if err != nil {
+			if *dwarfRegex {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entries matching %v", arg)
+	}
+
+	return entries, nil
+}
+
+// readEntry converts e and depth levels of its children.
+func readEntry(d *dwarf.Data, e *dwarf.Entry, depth int) (*DwarfEntry, error) {
+	de := &DwarfEntry{Offset: e.Offset, Tag: e.Tag.String()}
+	for _, f := range e.Field {
+		de.Attrs = append(de.Attrs, DwarfAttr{f.Attr.String(), attrValue(f)})
+	}
+	if e.Val(dwarf.AttrType) != nil {
+		if t, err := d.EntryType(e); err == nil {
+			de.Type = t.String()
+		}
+	}
+
+	if !e.Children || depth == 0 {
+		return de, nil
+	}
+
+	r := d.Reader()
+	r.Seek(e.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil, err
+	}
+	for {
+		c, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if c == nil || c.Tag == 0 {
+			break
+		}
+		dc, err := readEntry(d, c, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		de.Children = append(de.Children, dc)
+		if c.Children {
+			r.SkipChildren()
+		}
+	}
+
+	return de, nil
+}
+
+var dwarfLanguages = map[int64]string{
+	0x01:   "C89",
+	0x02:   "C",
+	0x04:   "C++",
+	0x0c:   "C99",
+	0x16:   "Go",
+	0x1c:   "Rust",
+	0x1d:   "C11",
+	0x8001: "Mips_Assembler",
+}
+
+// attrValue formats addresses and references in hex.
+func attrValue(f dwarf.Field) interface{} {
+	switch v := f.Val.(type) {
+	case dwarf.Offset:
+		return fmt.Sprintf("<0x%x>", uint32(v))
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	case int64:
+		if f.Attr == dwarf.AttrLanguage {
+			if name, ok := dwarfLanguages[v]; ok {
+				return name
+			}
+		}
+	case uint64:
+		switch f.Attr {
+		case dwarf.AttrLowpc, dwarf.AttrHighpc, dwarf.AttrEntrypc:
+			return fmt.Sprintf("0x%x", v)
+		}
+	}
+	return f.Val
+}
+
+func printEntry(de *DwarfEntry, indent int) {
+	ind := strings.Repeat("\t", indent)
+
+	fmt.Printf("%s<0x%x> %s\n", ind, uint32(de.Offset), de.Tag)
+	for _, a := range de.Attrs {
+		fmt.Printf("%s\t%s: %v\n", ind, a.Name, a.Value)
+	}
+	if de.Type != "" {
+		fmt.Printf("%s\ttype: %s\n", ind, de.Type)
+	}
+	for _, c := range de.Children {
+		printEntry(c, indent+1)
+	}
+}
+
+func (p *Process) PrintCompileUnits(d *dwarf.Data) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Offset", "Name", "Language", "Lowpc", "Producer",
+	})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			break
+		}
+		if e.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+
+		row := []string{fmt.Sprintf("0x%x", uint32(e.Offset))}
+		for _, a := range []dwarf.Attr{dwarf.AttrName, dwarf.AttrLanguage, dwarf.AttrLowpc, dwarf.AttrProducer} {
+			v := e.Val(a)
+			if v == nil {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, fmt.Sprint(attrValue(dwarf.Field{Attr: a, Val: v})))
+		}
+		table.Append(row)
+
+		r.SkipChildren()
+	}
+
+	table.Render()
+	return nil
+}
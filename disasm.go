@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/arch/arm64/arm64asm"
+	"golang.org/x/arch/x86/x86asm"
+	"golang.org/x/debug/elf"
+)
+
+var disasmSource = flag.Bool("source", true, "disasm: interleave source lines")
+
+// Lines returns the DWARF line tables of all compile units.
+func (p *Process) Lines() (*elf2.Lines, error) {
+	if p.lines != nil || p.linesErr != nil {
+		return p.lines, p.linesErr
+	}
+
+	efd, err := p.DebugFile()
+	if err == nil {
+		p.lines, err = elf2.ReadLines(efd)
+	}
+	p.linesErr = err
+
+	return p.lines, p.linesErr
+}
+
+// PCToLine maps pc to the source position by DWARF or by pclntab.
+func (p *Process) PCToLine(pc uint64) (string, int, bool) {
+	if lines, err := p.Lines(); err == nil {
+		if row, ok := lines.PCToLine(pc); ok {
+			return row.File, row.Line, true
+		}
+	}
+
+	if tab, err := p.GoSymTab(); err == nil {
+		if file, line, fn := tab.PCToLine(pc); fn != nil {
+			return file, line, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// textRange is a named address range to disassemble.
+type textRange struct {
+	name       string
+	start, end uint64
+}
+
+// LookupFuncs returns the functions matching name exactly or, if there
+// are none, as a regular expression.
+func (p *Process) LookupFuncs(name string) ([]textRange, error) {
+	var all []textRange
+	if tab, err := p.GoSymTab(); err == nil {
+		for _, fn := range tab.Funcs {
+			all = append(all, textRange{fn.Name, fn.Entry, fn.End})
+		}
+	}
+	if len(all) == 0 {
+		for _, s := range p.funcSymbols() {
+			all = append(all, textRange{s.Name, s.Value, s.Value + s.Size})
+		}
+	}
+
+	var res []textRange
+	for _, r := range all {
+		if r.name == name {
+			res = append(res, r)
+		}
+	}
+	if len(res) > 0 {
+		return res, nil
+	}
+
+	re, err := regexp.Compile(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range all {
+		if re.MatchString(r.name) {
+			res = append(res, r)
+		}
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("function %v not found", name)
+	}
+
+	return res, nil
+}
+
+// Disasm disassembles the functions or the address range addr:len given
+// by arg.
+func (p *Process) Disasm(arg string) error {
+	var ranges []textRange
+	if addr, size, err := parseRange(arg); err == nil {
+		if size, err = p.mappedLen(addr, size); err != nil {
+			return err
+		}
+		ranges = []textRange{{p.Symbolize(addr), addr, addr + size}}
+	} else if ranges, err = p.LookupFuncs(arg); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	src := sourceCache{}
+	for _, r := range ranges {
+		code := make([]byte, r.end-r.start)
+		n, err := p.Memory().ReadAt(code, int64(r.start))
+		if err != nil && n == 0 {
+			return fmt.Errorf("read %v failed: %v", r.name, err)
+		}
+
+		file, _, _ := p.PCToLine(r.start)
+		fmt.Fprintf(w, "TEXT %s(SB) %s\n", r.name, file)
+
+		var lastFile string
+		var lastLine int
+		for pc := r.start; pc < r.start+uint64(n); {
+			text, size := p.decode(code[pc-r.start:n], pc)
+
+			file, line, ok := p.PCToLine(pc)
+			if *disasmSource && ok && (file != lastFile || line != lastLine) {
+				fmt.Fprintf(w, "  %s:%d\t%s\n", file, line, src.line(file, line))
+				lastFile, lastLine = file, line
+			}
+
+			fmt.Fprintf(w, "\t0x%x\t%-20x\t%s\n", pc, code[pc-r.start:pc-r.start+uint64(size)], text)
+			pc += uint64(size)
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// decode disassembles the instruction at the start of code in Go syntax.
+func (p *Process) decode(code []byte, pc uint64) (string, int) {
+	symname := func(addr uint64) (string, uint64) {
+		name, entry, ok := p.LookupAddr(addr)
+		if !ok {
+			return "", 0
+		}
+		return name, entry
+	}
+
+	switch p.efd.Machine {
+	case elf.EM_X86_64, elf.EM_386:
+		mode := 64
+		if p.efd.Machine == elf.EM_386 {
+			mode = 32
+		}
+		inst, err := x86asm.Decode(code, mode)
+		if err != nil || inst.Len == 0 || inst.Op == 0 {
+			return "?", 1
+		}
+		return x86asm.GoSyntax(inst, pc, symname), inst.Len
+	case elf2.EM_AARCH64:
+		if len(code) < 4 {
+			return "?", len(code)
+		}
+		inst, err := arm64asm.Decode(code)
+		if err != nil {
+			return "?", 4
+		}
+		return arm64asm.GoSyntax(inst, pc, symname, p.Memory()), 4
+	}
+
+	return fmt.Sprintf("? unsupported machine %v", p.efd.Machine), len(code)
+}
+
+// sourceCache holds the lines of source files read so far.
+type sourceCache map[string][]string
+
+func (c sourceCache) line(file string, line int) string {
+	lines, ok := c[file]
+	if !ok {
+		if b, err := ioutil.ReadFile(file); err == nil {
+			lines = strings.Split(string(b), "\n")
+		}
+		c[file] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
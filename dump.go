@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+)
+
+var dumpSectionName = flag.String("section", "", "dump: section name")
+var dumpSegment = flag.Int("segment", -1, "dump: program header index")
+var dumpVaddr = flag.String("vaddr", "", "dump: virtual address range addr:len")
+var dumpOutput = flag.StringP("output", "o", "", "dump: write raw bytes to the file instead of hexdump, gcore: core file (core.<pid>), core redact: redacted core file")
+
+// Memory returns the address space of the process built of the PT_LOAD
+// segments of the ELF file (executable or core). With --core the core
+// is read first and the executable fills in what was not dumped.
+func (p *Process) Memory() elf2.Memory {
+	if p.mem == nil {
+		if p.proc != nil {
+			p.mem = elf2.NewOverlayMemory(p.proc, elf2.NewProgMemory(p.efd))
+		} else if p.core != nil {
+			p.mem = elf2.NewOverlayMemory(elf2.NewProgMemory(p.core), elf2.NewProgMemory(p.efd))
+		} else {
+			p.mem = elf2.NewProgMemory(p.efd)
+		}
+	}
+	return p.mem
+}
+
+func (p *Process) Dump() error {
+	var addr uint64
+	var data []byte
+
+	switch {
+	case *dumpSectionName != "":
+		s := elf2.DebugSection(p.efd, *dumpSectionName)
+		if s == nil {
+			return fmt.Errorf("section %v not found", *dumpSectionName)
+		}
+		b, err := elf2.SectionData(p.efd, s)
+		if err != nil {
+			return err
+		}
+		addr, data = s.Addr, b
+		if addr == 0 {
+			addr = s.Offset
+		}
+	case *dumpSegment >= 0:
+		if *dumpSegment >= len(p.efd.Progs) {
+			return fmt.Errorf("segment %d out of range [0, %d)", *dumpSegment, len(p.efd.Progs))
+		}
+		prog := p.efd.Progs[*dumpSegment]
+		b, err := ioutil.ReadAll(io.NewSectionReader(prog, 0, int64(prog.Filesz)))
+		if err != nil {
+			return err
+		}
+		addr, data = prog.Vaddr, b
+	case *dumpVaddr != "":
+		a, n, err := parseRange(*dumpVaddr)
+		if err != nil {
+			return err
+		}
+		if n, err = p.mappedLen(a, n); err != nil {
+			return err
+		}
+		b := make([]byte, n)
+		k, err := p.Memory().ReadAt(b, int64(a))
+		if err != nil && k == 0 {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Short read:", err)
+		}
+		addr, data = a, b[:k]
+	default:
+		return fmt.Errorf("one of --section, --segment or --vaddr is required")
+	}
+
+	if *dumpOutput != "" {
+		return ioutil.WriteFile(*dumpOutput, data, 0644)
+	}
+
+	HexDump(os.Stdout, addr, data)
+	return nil
+}
+
+// mappedLen caps the length of the range at addr to the end of the
+// mappings following addr without holes.
+func (p *Process) mappedLen(addr, n uint64) (uint64, error) {
+	var end uint64
+	for _, m := range p.Memory().Mappings() {
+		if end == 0 {
+			if m.Contains(addr) {
+				end = m.End
+			}
+			continue
+		}
+		if m.Start != end {
+			break
+		}
+		end = m.End
+	}
+	if end == 0 {
+		return 0, fmt.Errorf("address 0x%x is not mapped", addr)
+	}
+	if n > end-addr {
+		n = end - addr
+	}
+	return n, nil
+}
+
+// parseRange parses "addr:len" or "addr" (len defaults to 256),
+// both numbers may be given in any strconv base notation.
+func parseRange(s string) (uint64, uint64, error) {
+	parts := strings.SplitN(s, ":", 2)
+
+	addr, err := strconv.ParseUint(parts[0], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q: %v", parts[0], err)
+	}
+
+	size := uint64(256)
+	if len(parts) == 2 {
+		if size, err = strconv.ParseUint(parts[1], 0, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid length %q: %v", parts[1], err)
+		}
+	}
+
+	return addr, size, nil
+}
+
+// HexDump writes data in the `hexdump -C` format prefixed by addresses.
+func HexDump(w io.Writer, addr uint64, data []byte) {
+	var line [16]byte
+
+	for off := 0; off < len(data); off += 16 {
+		n := copy(line[:], data[off:])
+
+		hex := make([]string, 16)
+		ascii := make([]byte, n)
+		for i := 0; i < 16; i++ {
+			if i >= n {
+				hex[i] = "  "
+				continue
+			}
+			hex[i] = fmt.Sprintf("%02x", line[i])
+			if line[i] >= 0x20 && line[i] < 0x7f {
+				ascii[i] = line[i]
+			} else {
+				ascii[i] = '.'
+			}
+		}
+
+		fmt.Fprintf(w, "%016x  %s  %s  |%s|\n",
+			addr+uint64(off),
+			strings.Join(hex[:8], " "),
+			strings.Join(hex[8:], " "),
+			ascii)
+	}
+}
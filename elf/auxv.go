@@ -0,0 +1,133 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+
+	"golang.org/x/debug/elf"
+)
+
+// AuxvTag is the type of an auxiliary vector entry.
+type AuxvTag uint64
+
+const (
+	AT_NULL         AuxvTag = 0
+	AT_PHDR         AuxvTag = 3
+	AT_PHENT        AuxvTag = 4
+	AT_PHNUM        AuxvTag = 5
+	AT_PAGESZ       AuxvTag = 6
+	AT_BASE         AuxvTag = 7
+	AT_ENTRY        AuxvTag = 9
+	AT_PLATFORM     AuxvTag = 15
+	AT_HWCAP        AuxvTag = 16
+	AT_CLKTCK       AuxvTag = 17
+	AT_RANDOM       AuxvTag = 25
+	AT_EXECFN       AuxvTag = 31
+	AT_SYSINFO_EHDR AuxvTag = 33
+)
+
+// http://lxr.free-electrons.com/source/include/uapi/linux/auxvec.h
+var auxvStrings = []intName{
+	{0, "AT_NULL"},
+	{1, "AT_IGNORE"},
+	{2, "AT_EXECFD"},
+	{3, "AT_PHDR"},
+	{4, "AT_PHENT"},
+	{5, "AT_PHNUM"},
+	{6, "AT_PAGESZ"},
+	{7, "AT_BASE"},
+	{8, "AT_FLAGS"},
+	{9, "AT_ENTRY"},
+	{10, "AT_NOTELF"},
+	{11, "AT_UID"},
+	{12, "AT_EUID"},
+	{13, "AT_GID"},
+	{14, "AT_EGID"},
+	{15, "AT_PLATFORM"},
+	{16, "AT_HWCAP"},
+	{17, "AT_CLKTCK"},
+	{23, "AT_SECURE"},
+	{24, "AT_BASE_PLATFORM"},
+	{25, "AT_RANDOM"},
+	{26, "AT_HWCAP2"},
+	{27, "AT_RSEQ_FEATURE_SIZE"},
+	{28, "AT_RSEQ_ALIGN"},
+	{29, "AT_HWCAP3"},
+	{30, "AT_HWCAP4"},
+	{31, "AT_EXECFN"},
+	{32, "AT_SYSINFO"},
+	{33, "AT_SYSINFO_EHDR"},
+	{51, "AT_MINSIGSTKSZ"},
+}
+
+func (t AuxvTag) String() string {
+	for _, n := range auxvStrings {
+		if uint64(n.i) == uint64(t) {
+			return n.s
+		}
+	}
+	return "AT_" + strconv.FormatUint(uint64(t), 10)
+}
+
+// Auxv is an entry of the auxiliary vector the kernel passes to the
+// process (/proc/<pid>/auxv or NT_AUXV of a core).
+type Auxv struct {
+	Tag AuxvTag
+	Val uint64
+}
+
+// ParseAuxv decodes the auxiliary vector up to AT_NULL.
+func ParseAuxv(data []byte, o binary.ByteOrder, c elf.Class) ([]Auxv, error) {
+	size := 8
+	if c == elf.ELFCLASS32 {
+		size = 4
+	}
+	word := func(b []byte) uint64 {
+		if size == 4 {
+			return uint64(o.Uint32(b))
+		}
+		return o.Uint64(b)
+	}
+
+	var auxv []Auxv
+	for len(data) >= 2*size {
+		a := Auxv{Tag: AuxvTag(word(data)), Val: word(data[size:])}
+		if a.Tag == AT_NULL {
+			return auxv, nil
+		}
+		auxv = append(auxv, a)
+		data = data[2*size:]
+	}
+	if len(data) != 0 {
+		return auxv, errors.New("truncated auxiliary vector")
+	}
+	return auxv, nil
+}
+
+// EncodeAuxv encodes the auxiliary vector terminated by AT_NULL.
+func EncodeAuxv(auxv []Auxv, o binary.ByteOrder, c elf.Class) ([]byte, error) {
+	b := &bytes.Buffer{}
+	for _, a := range append(auxv, Auxv{Tag: AT_NULL}) {
+		if err := writeUInt(b, o, c, uint64(a.Tag)); err != nil {
+			return nil, err
+		}
+		writeUInt(b, o, c, a.Val)
+	}
+	return b.Bytes(), nil
+}
+
+// CoreAuxv returns the auxiliary vector saved in the NT_AUXV note of the core.
+func CoreAuxv(core *elf.File) ([]Auxv, error) {
+	notes, err := ReadAllNotes(core)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range notes {
+		if n.Name == "CORE" && n.Type == NT_AUXV {
+			return ParseAuxv(n.Data, core.ByteOrder, core.Class)
+		}
+	}
+	return nil, errors.New("no NT_AUXV note")
+}
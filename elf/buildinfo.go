@@ -0,0 +1,155 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+var buildInfoMagic = []byte("\xff Go buildinf:")
+
+// Module is a module line of the embedded build info.
+type Module struct {
+	Path    string
+	Version string
+	Sum     string
+	Replace *Module
+}
+
+// BuildInfo is the toolchain version and module information embedded by
+// the Go linker in .go.buildinfo (see runtime/debug.BuildInfo).
+type BuildInfo struct {
+	GoVersion string
+	Path      string
+	Main      Module
+	Deps      []*Module
+	Settings  [][2]string
+}
+
+// ReadBuildInfo decodes .go.buildinfo. Since Go 1.18 the strings are
+// stored inline, older versions store pointers to string headers that
+// are read from mem.
+func ReadBuildInfo(f *elf.File, mem Memory) (*BuildInfo, error) {
+	s := f.Section(".go.buildinfo")
+	if s == nil {
+		return nil, errors.New("no .go.buildinfo section")
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 32 || !bytes.HasPrefix(data, buildInfoMagic) {
+		return nil, errors.New("invalid .go.buildinfo header")
+	}
+
+	ptrSize := int(data[14])
+	flags := data[15]
+	var order binary.ByteOrder = binary.LittleEndian
+	if flags&1 != 0 {
+		order = binary.BigEndian
+	}
+
+	var vers, mod string
+	if flags&2 != 0 {
+		rest := data[32:]
+		if vers, rest, err = varintString(rest); err != nil {
+			return nil, err
+		}
+		if mod, _, err = varintString(rest); err != nil {
+			return nil, err
+		}
+	} else {
+		if ptrSize != 4 && ptrSize != 8 {
+			return nil, fmt.Errorf("invalid pointer size %d", ptrSize)
+		}
+		r := &MemReader{Memory: mem, Order: order, PtrSize: ptrSize}
+		if vers, err = r.String(r.word(data[16:]), 1<<10); err != nil {
+			return nil, fmt.Errorf("read version failed: %v", err)
+		}
+		if mod, err = r.String(r.word(data[16+ptrSize:]), 1<<20); err != nil {
+			return nil, fmt.Errorf("read modinfo failed: %v", err)
+		}
+	}
+
+	bi := &BuildInfo{GoVersion: vers}
+	// modinfo is wrapped in 16 bytes sentinels.
+	if len(mod) >= 33 && mod[len(mod)-17] == '\n' {
+		bi.parseModInfo(mod[16 : len(mod)-16])
+	}
+
+	return bi, nil
+}
+
+func varintString(b []byte) (string, []byte, error) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b)-k) {
+		return "", nil, errors.New("invalid varint string")
+	}
+	return string(b[k : k+int(n)]), b[k+int(n):], nil
+}
+
+func (bi *BuildInfo) parseModInfo(s string) {
+	var last *Module
+	for _, line := range strings.Split(s, "\n") {
+		f := strings.Split(line, "\t")
+		switch {
+		case len(f) >= 2 && f[0] == "path":
+			bi.Path = f[1]
+		case len(f) >= 3 && f[0] == "mod":
+			bi.Main = Module{Path: f[1], Version: f[2]}
+			if len(f) >= 4 {
+				bi.Main.Sum = f[3]
+			}
+			last = &bi.Main
+		case len(f) >= 3 && f[0] == "dep":
+			m := &Module{Path: f[1], Version: f[2]}
+			if len(f) >= 4 {
+				m.Sum = f[3]
+			}
+			bi.Deps = append(bi.Deps, m)
+			last = m
+		case len(f) >= 3 && f[0] == "=>" && last != nil:
+			last.Replace = &Module{Path: f[1], Version: f[2]}
+			if len(f) >= 4 {
+				last.Replace.Sum = f[3]
+			}
+		case len(f) >= 2 && f[0] == "build":
+			if kv := strings.SplitN(f[1], "=", 2); len(kv) == 2 {
+				bi.Settings = append(bi.Settings, [2]string{kv[0], kv[1]})
+			}
+		}
+	}
+}
+
+// GoVersion is the major release of the Go toolchain, i.e. 1.21 for "go1.21.3".
+type GoVersion struct {
+	Major, Minor int
+}
+
+// ParseGoVersion extracts the release from the runtime.Version() format
+// including devel versions like "devel go1.22-abcdef".
+func ParseGoVersion(s string) (GoVersion, error) {
+	i := strings.Index(s, "go1.")
+	if i < 0 {
+		return GoVersion{}, fmt.Errorf("invalid go version %q", s)
+	}
+	s = s[i+len("go1."):]
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	minor, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return GoVersion{}, fmt.Errorf("invalid go version %q", s)
+	}
+	return GoVersion{1, minor}, nil
+}
+
+func (v GoVersion) AtLeast(minor int) bool { return v.Major > 1 || v.Minor >= minor }
+
+func (v GoVersion) String() string { return fmt.Sprintf("go%d.%d", v.Major, v.Minor) }
@@ -0,0 +1,219 @@
+package elf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/sitano/goelf/internal/zstd"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+// SHF_COMPRESSED is missing in golang.org/x/debug/elf.
+const SHF_COMPRESSED elf.SectionFlag = 0x800
+
+type CompressionType uint32
+
+const (
+	ELFCOMPRESS_ZLIB CompressionType = 1
+	ELFCOMPRESS_ZSTD CompressionType = 2
+)
+
+var compressionStrings = []intName{
+	{1, "ELFCOMPRESS_ZLIB"},
+	{2, "ELFCOMPRESS_ZSTD"},
+}
+
+func (i CompressionType) String() string   { return stringName(uint32(i), compressionStrings, false) }
+func (i CompressionType) GoString() string { return stringName(uint32(i), compressionStrings, true) }
+
+// Chdr is the compression header of SHF_COMPRESSED sections
+// (Elf32_Chdr/Elf64_Chdr).
+type Chdr struct {
+	Type      CompressionType
+	Size      uint64
+	Addralign uint64
+}
+
+// IsCompressed reports whether the section data is compressed either
+// with SHF_COMPRESSED or in the legacy .zdebug_* format.
+func IsCompressed(s *elf.Section) bool {
+	return s.Flags&SHF_COMPRESSED != 0 || strings.HasPrefix(s.Name, ".zdebug_")
+}
+
+// ReadChdr reads the compression header at the beginning of r.
+func ReadChdr(r io.Reader, o binary.ByteOrder, c elf.Class) (*Chdr, error) {
+	ch := &Chdr{}
+
+	switch c {
+	case elf.ELFCLASS64:
+		var hdr struct {
+			Type      uint32
+			Reserved  uint32
+			Size      uint64
+			Addralign uint64
+		}
+		if err := binary.Read(r, o, &hdr); err != nil {
+			return nil, fmt.Errorf("read chdr failed: %v", err)
+		}
+		ch.Type, ch.Size, ch.Addralign = CompressionType(hdr.Type), hdr.Size, hdr.Addralign
+	case elf.ELFCLASS32:
+		var hdr struct {
+			Type      uint32
+			Size      uint32
+			Addralign uint32
+		}
+		if err := binary.Read(r, o, &hdr); err != nil {
+			return nil, fmt.Errorf("read chdr failed: %v", err)
+		}
+		ch.Type, ch.Size, ch.Addralign = CompressionType(hdr.Type), uint64(hdr.Size), uint64(hdr.Addralign)
+	default:
+		return nil, errors.New("unknown elf class")
+	}
+
+	return ch, nil
+}
+
+// SectionData returns the section contents, transparently decompressing
+// SHF_COMPRESSED (zlib and zstd) and .zdebug_* (zlib) sections.
+func SectionData(f *elf.File, s *elf.Section) ([]byte, error) {
+	if s.Type == elf.SHT_NOBITS {
+		return []byte{}, nil
+	}
+
+	data, err := s.Data()
+	if err != nil && uint64(len(data)) < s.Size {
+		return nil, err
+	}
+
+	switch {
+	case s.Flags&SHF_COMPRESSED != 0:
+		r := bytes.NewReader(data)
+		ch, err := ReadChdr(r, f.ByteOrder, f.Class)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", s.Name, err)
+		}
+		return decompress(s.Name, ch.Type, r, ch.Size)
+	case strings.HasPrefix(s.Name, ".zdebug_"):
+		// "ZLIB" followed by the 8 byte big-endian uncompressed size.
+		if len(data) < 12 || string(data[:4]) != "ZLIB" {
+			return data, nil
+		}
+		size := binary.BigEndian.Uint64(data[4:12])
+		return decompress(s.Name, ELFCOMPRESS_ZLIB, bytes.NewReader(data[12:]), size)
+	}
+
+	return data, nil
+}
+
+func decompress(name string, typ CompressionType, r io.Reader, size uint64) ([]byte, error) {
+	var dr io.Reader
+
+	switch typ {
+	case ELFCOMPRESS_ZLIB:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		defer zr.Close()
+		dr = zr
+	case ELFCOMPRESS_ZSTD:
+		dr = zstd.NewReader(r)
+	default:
+		return nil, fmt.Errorf("%v: unsupported compression %v", name, typ)
+	}
+
+	// size comes from the file, so the buffer grows with the data
+	// actually decompressed instead of being allocated upfront
+	if size >= math.MaxInt64 {
+		return nil, fmt.Errorf("%v: invalid uncompressed size %d", name, size)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(dr, int64(size)+1)); err != nil {
+		return nil, fmt.Errorf("%v: decompress failed: %v", name, err)
+	}
+	if uint64(buf.Len()) != size {
+		return nil, fmt.Errorf("%v: decompressed %d bytes instead of %d", name, buf.Len(), size)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DebugSection returns the section by its .debug_* name falling back
+// to the legacy compressed .zdebug_* name.
+func DebugSection(f *elf.File, name string) *elf.Section {
+	if s := f.Section(name); s != nil {
+		return s
+	}
+	if strings.HasPrefix(name, ".debug_") {
+		return f.Section(".zdebug_" + name[len(".debug_"):])
+	}
+	return nil
+}
+
+// LoadDWARF is the elf.File.DWARF() that understands compressed debug
+// sections. Uncompressed object files are still loaded by
+// golang.org/x/debug/elf so that their relocations are applied.
+//
+// DWARF 5 units are rewritten to version 4 first, see dwarf5.downgrade.
+// .debug_line is left out: line tables are decoded by ReadLines, the
+// vendored reader only knows the first one and no DWARF 5.
+func LoadDWARF(f *elf.File) (*dwarf.Data, error) {
+	compressed := false
+	for _, s := range f.Sections {
+		if strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_") {
+			compressed = compressed || IsCompressed(s)
+		}
+	}
+	if !compressed && f.Type == elf.ET_REL {
+		return f.DWARF()
+	}
+
+	var names = [...]string{"abbrev", "frame", "info", "str", "str_offsets", "addr", "line_str"}
+	var dat [len(names)][]byte
+	for i, name := range names {
+		s := DebugSection(f, ".debug_"+name)
+		if s == nil {
+			continue
+		}
+		b, err := SectionData(f, s)
+		if err != nil {
+			return nil, err
+		}
+		dat[i] = b
+	}
+
+	abbrev, frame, info, str := dat[0], dat[1], dat[2], dat[3]
+	if hasDWARF5(info, f.ByteOrder) {
+		d5 := &dwarf5{abbrev: abbrev, info: info, str: str, strOffsets: dat[4], addr: dat[5], lineStr: dat[6]}
+		var err error
+		if abbrev, info, str, err = d5.downgrade(f.ByteOrder); err != nil {
+			return nil, fmt.Errorf("decoding dwarf 5 section info: %v", err)
+		}
+	}
+	d, err := dwarf.New(abbrev, nil, frame, info, nil, nil, nil, str)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, s := range f.Sections {
+		if s.Name != ".debug_types" && s.Name != ".zdebug_types" {
+			continue
+		}
+		b, err := SectionData(f, s)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.AddTypes(fmt.Sprintf("types-%d", i), b); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
@@ -0,0 +1,339 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/debug/elf"
+)
+
+// PN_XNUM in e_phnum tells the number of program headers is in sh_info
+// of the first section header.
+const pnXNum = 0xffff
+
+// CoreSegment is a PT_LOAD segment of a core. The first Filesz bytes are
+// dumped, the rest up to Memsz is reported as not dumped to the readers.
+type CoreSegment struct {
+	Vaddr  uint64
+	Memsz  uint64
+	Filesz uint64
+	Flags  elf.ProgFlag
+
+	// Data is read at the virtual addresses of the segment, e.g. a Memory.
+	Data io.ReaderAt
+}
+
+// CoreWriter lays out an ELF core: the header, the program headers, the
+// PT_NOTE segment with the notes and the page aligned PT_LOAD segments.
+type CoreWriter struct {
+	Class    elf.Class
+	Order    binary.ByteOrder
+	Machine  elf.Machine
+	OSABI    elf.OSABI
+	PageSize uint64
+
+	// Policy selects the memory dumped by AddMapping, also the pages of
+	// zeros are left as holes if it is sparse.
+	Policy *DumpPolicy
+
+	Notes    []*Note
+	Segments []*CoreSegment
+
+	// Unreadable is the number of bytes of the segments that could not be
+	// read and were written as zeros.
+	Unreadable uint64
+}
+
+func NewCoreWriter(c elf.Class, o binary.ByteOrder, m elf.Machine) *CoreWriter {
+	return &CoreWriter{Class: c, Order: o, Machine: m, PageSize: 4096, Policy: DefaultDumpPolicy()}
+}
+
+func (cw *CoreWriter) AddNote(name string, t NoteType, data []byte) {
+	cw.Notes = append(cw.Notes, &Note{Name: name, Type: t, Data: data})
+}
+
+func (cw *CoreWriter) AddSegment(s *CoreSegment) {
+	cw.Segments = append(cw.Segments, s)
+}
+
+// AddMapping adds the segment of the mapping dumped as the policy says.
+// Data is read from mem.
+func (cw *CoreWriter) AddMapping(m *Mapping, mem io.ReaderAt) {
+	policy := cw.Policy
+	if policy == nil {
+		policy = DefaultDumpPolicy()
+	}
+	cw.AddSegment(&CoreSegment{
+		Vaddr:  m.Start,
+		Memsz:  m.Size(),
+		Filesz: policy.DumpSize(m, mem, cw.PageSize),
+		Flags:  m.Flags,
+		Data:   mem,
+	})
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+	// the file ends with a hole
+	hole bool
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.hole = cw.hole && n == 0
+	return n, err
+}
+
+// skip seeks over n bytes leaving a hole.
+func (cw *countWriter) skip(n int64) error {
+	if _, err := cw.w.(io.Seeker).Seek(n, io.SeekCurrent); err != nil {
+		return err
+	}
+	cw.n += n
+	cw.hole = n > 0
+	return nil
+}
+
+// WriteTo writes the core sequentially.
+func (cw *CoreWriter) WriteTo(w io.Writer) (int64, error) {
+	var ehsize, phsize, shsize uint64
+	switch cw.Class {
+	case elf.ELFCLASS64:
+		ehsize, phsize, shsize = 64, 56, 64
+	case elf.ELFCLASS32:
+		ehsize, phsize, shsize = 52, 32, 40
+	default:
+		return 0, errors.New("unknown elf class")
+	}
+	if cw.PageSize == 0 || cw.PageSize&(cw.PageSize-1) != 0 {
+		return 0, fmt.Errorf("invalid page size %d", cw.PageSize)
+	}
+
+	sparse := cw.Policy != nil && cw.Policy.Sparse
+	if _, ok := w.(io.WriteSeeker); sparse && !ok {
+		return 0, errors.New("sparse core needs a seekable writer")
+	}
+
+	notes := EncodeNotes(cw.Notes, cw.Order)
+
+	phnum := uint64(1 + len(cw.Segments))
+	var shoff uint64
+	notesOff := ehsize + phnum*phsize
+	if phnum >= pnXNum {
+		// the extended numbering section header follows the program headers
+		shoff = notesOff
+		notesOff += shsize
+	}
+	dataOff := (notesOff + uint64(len(notes)) + cw.PageSize - 1) &^ (cw.PageSize - 1)
+
+	progs := []elf.Prog64{{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    notesOff,
+		Filesz: uint64(len(notes)),
+		Align:  4,
+	}}
+	off := dataOff
+	for _, s := range cw.Segments {
+		if s.Filesz > s.Memsz {
+			return 0, fmt.Errorf("segment 0x%x: file size 0x%x is above memory size 0x%x", s.Vaddr, s.Filesz, s.Memsz)
+		}
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(s.Flags),
+			Off:    off,
+			Vaddr:  s.Vaddr,
+			Filesz: s.Filesz,
+			Memsz:  s.Memsz,
+			Align:  cw.PageSize,
+		})
+		off += s.Filesz
+	}
+
+	cnt := &countWriter{w: w}
+	if err := cw.writeHeaders(cnt, ehsize, phsize, shsize, shoff, progs); err != nil {
+		return cnt.n, err
+	}
+	if _, err := cnt.Write(notes); err != nil {
+		return cnt.n, err
+	}
+	if _, err := cnt.Write(make([]byte, dataOff-uint64(cnt.n))); err != nil {
+		return cnt.n, err
+	}
+
+	buf := make([]byte, 1<<16)
+	for _, s := range cw.Segments {
+		if err := cw.copySegment(cnt, s, buf, sparse); err != nil {
+			return cnt.n, fmt.Errorf("segment 0x%x: %v", s.Vaddr, err)
+		}
+	}
+
+	// a hole at the end does not extend the file
+	if cnt.hole {
+		if err := cnt.skip(-1); err != nil {
+			return cnt.n, err
+		}
+		if _, err := cnt.Write([]byte{0}); err != nil {
+			return cnt.n, err
+		}
+	}
+
+	return cnt.n, nil
+}
+
+func (cw *CoreWriter) writeHeaders(w io.Writer, ehsize, phsize, shsize, shoff uint64, progs []elf.Prog64) error {
+	o := cw.Order
+
+	var ident [elf.EI_NIDENT]byte
+	copy(ident[:], elf.ELFMAG)
+	ident[elf.EI_CLASS] = byte(cw.Class)
+	ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	if o == binary.BigEndian {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	ident[elf.EI_OSABI] = byte(cw.OSABI)
+
+	phnum, shnum := uint64(len(progs)), uint64(0)
+	if phnum >= pnXNum {
+		phnum, shnum = pnXNum, 1
+	}
+
+	if cw.Class == elf.ELFCLASS64 {
+		hdr := elf.Header64{
+			Ident:     ident,
+			Type:      uint16(elf.ET_CORE),
+			Machine:   uint16(cw.Machine),
+			Version:   uint32(elf.EV_CURRENT),
+			Phoff:     ehsize,
+			Shoff:     shoff,
+			Ehsize:    uint16(ehsize),
+			Phentsize: uint16(phsize),
+			Phnum:     uint16(phnum),
+			Shentsize: uint16(shsize),
+			Shnum:     uint16(shnum),
+		}
+		if err := binary.Write(w, o, &hdr); err != nil {
+			return err
+		}
+		if err := binary.Write(w, o, progs); err != nil {
+			return err
+		}
+		if shnum > 0 {
+			return binary.Write(w, o, &elf.Section64{Info: uint32(len(progs))})
+		}
+		return nil
+	}
+
+	hdr := elf.Header32{
+		Ident:     ident,
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(cw.Machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     uint32(ehsize),
+		Shoff:     uint32(shoff),
+		Ehsize:    uint16(ehsize),
+		Phentsize: uint16(phsize),
+		Phnum:     uint16(phnum),
+		Shentsize: uint16(shsize),
+		Shnum:     uint16(shnum),
+	}
+	if err := binary.Write(w, o, &hdr); err != nil {
+		return err
+	}
+	for _, p := range progs {
+		if p.Off > 1<<32-1 || p.Vaddr+p.Memsz > 1<<32 {
+			return fmt.Errorf("segment 0x%x does not fit 32-bit core", p.Vaddr)
+		}
+		p32 := elf.Prog32{
+			Type:   p.Type,
+			Off:    uint32(p.Off),
+			Vaddr:  uint32(p.Vaddr),
+			Filesz: uint32(p.Filesz),
+			Memsz:  uint32(p.Memsz),
+			Flags:  p.Flags,
+			Align:  uint32(p.Align),
+		}
+		if err := binary.Write(w, o, &p32); err != nil {
+			return err
+		}
+	}
+	if shnum > 0 {
+		return binary.Write(w, o, &elf.Section32{Info: uint32(len(progs))})
+	}
+	return nil
+}
+
+// copySegment writes the dumped part of the segment. Pages that can not
+// be read (e.g. PROT_NONE guards) are written as zeros.
+func (cw *CoreWriter) copySegment(w *countWriter, s *CoreSegment, buf []byte, sparse bool) error {
+	end := s.Vaddr + s.Filesz
+	for a := s.Vaddr; a < end; {
+		chunk := buf
+		if rest := end - a; rest < uint64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+
+		n, err := s.Data.ReadAt(chunk, int64(a))
+		if err != nil && n < len(chunk) {
+			// retry up to the page boundary
+			n = len(chunk)
+			if next := (a + cw.PageSize) &^ (cw.PageSize - 1); next-a < uint64(n) {
+				n = int(next - a)
+			}
+			chunk = chunk[:n]
+			if k, err := s.Data.ReadAt(chunk, int64(a)); err != nil && k < n {
+				for i := range chunk {
+					chunk[i] = 0
+				}
+				cw.Unreadable += uint64(n)
+			}
+		}
+
+		if sparse {
+			if err := cw.writeSparse(w, chunk[:n]); err != nil {
+				return err
+			}
+		} else if _, err := w.Write(chunk[:n]); err != nil {
+			return err
+		}
+		a += uint64(n)
+	}
+	return nil
+}
+
+// writeSparse skips over the pages of zeros. Segments are page aligned in
+// the file, so are the pages of b except the last one.
+func (cw *CoreWriter) writeSparse(w *countWriter, b []byte) error {
+	for len(b) > 0 {
+		n := int(cw.PageSize)
+		if n > len(b) {
+			n = len(b)
+		}
+		page := b[:n]
+		b = b[n:]
+
+		if isZero(page) {
+			if err := w.skip(int64(n)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,613 @@
+package elf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+	"golang.org/x/debug/dwarf"
+)
+
+// maxWaiters limits walking corrupted lists of sudogs.
+const maxWaiters = 1 << 20
+
+// chanWaits are the wait reasons of goroutines blocked on channels.
+var chanWaits = map[string]bool{
+	"chan receive":            true,
+	"chan send":               true,
+	"select":                  true,
+	"chan receive (nil chan)": true,
+	"chan send (nil chan)":    true,
+	"select (no cases)":       true,
+}
+
+// WaitObject is a lock or a channel goroutines are blocked on.
+type WaitObject struct {
+	Addr uint64
+	// Kind is sync.Mutex, sync.RWMutex or chan. Goroutines blocked on a
+	// nil channel or an empty select wait on the chan at 0.
+	Kind  string
+	State string
+
+	Waiters []*Goroutine
+	// Holders are the goroutines which may hold the lock or operate on
+	// the other end of the channel: the ones not waiting on the object
+	// with its address on their stacks or, for package-level locks
+	// which are not on stacks, stopped past the code taking the lock.
+	// The runtime does not record lock owners, so the holders are a
+	// guess.
+	Holders []*Goroutine
+}
+
+// WaitGraph is what the blocked goroutines wait for.
+type WaitGraph struct {
+	Objects []*WaitObject
+	// Waits are the objects a goroutine is blocked on, several for
+	// select.
+	Waits map[*Goroutine][]*WaitObject
+}
+
+// ReadWaitGraph finds the objects the goroutines are blocked on: the
+// locks by the semaphores in runtime.semtable, the channels by the sudogs
+// of g.waiting.
+func ReadWaitGraph(u *Unwinder, d *dwarf.Data, gs []*Goroutine) (*WaitGraph, error) {
+	r := u.R
+	sudog, err := typeOf(d, "runtime.sudog")
+	if err != nil {
+		return nil, err
+	}
+	w := &WaitGraph{Waits: map[*Goroutine][]*WaitObject{}}
+	objects := map[string]*WaitObject{}
+	wait := func(g *Goroutine, kind string, addr uint64) {
+		key := fmt.Sprintf("%s %x", kind, addr)
+		o := objects[key]
+		if o == nil {
+			o = &WaitObject{Addr: addr, Kind: kind}
+			objects[key] = o
+			w.Objects = append(w.Objects, o)
+		}
+		for _, waiter := range o.Waiters {
+			if waiter == g {
+				return
+			}
+		}
+		o.Waiters = append(o.Waiters, g)
+		w.Waits[g] = append(w.Waits[g], o)
+	}
+
+	byAddr := map[uint64]*Goroutine{}
+	for _, g := range gs {
+		byAddr[g.Addr] = g
+	}
+
+	sema, err := semaWaiters(r, d, sudog)
+	if err != nil {
+		return nil, err
+	}
+	mutexSema := fieldOffset(d, "sync.Mutex", []string{"mu", "sema"}, []string{"sema"})
+	readerSem := fieldOffset(d, "sync.RWMutex", []string{"readerSem"})
+	writerSem := fieldOffset(d, "sync.RWMutex", []string{"writerSem"})
+	for _, s := range sema {
+		g := byAddr[s.g]
+		if g == nil || g.Status != gWaiting {
+			continue
+		}
+		switch g.WaitReason {
+		case "sync.Mutex.Lock":
+			wait(g, "sync.Mutex", s.addr-mutexSema)
+		case "sync.RWMutex.RLock":
+			wait(g, "sync.RWMutex", s.addr-readerSem)
+		case "sync.RWMutex.Lock":
+			wait(g, "sync.RWMutex", s.addr-writerSem)
+		}
+	}
+
+	for _, g := range gs {
+		if g.Status != gWaiting || !chanWaits[g.WaitReason] {
+			continue
+		}
+		if g.Waiting == 0 {
+			wait(g, "chan", 0)
+			continue
+		}
+		for s, n := g.Waiting, 0; s != 0 && n < maxWaiters; n++ {
+			v := NewValue(r, s, sudog)
+			if c := sudogPtr(v, "c"); c != 0 {
+				wait(g, "chan", c)
+			}
+			s = uintPath(v, "waitlink")
+		}
+	}
+
+	for _, o := range w.Objects {
+		o.State = objectState(r, d, o)
+	}
+	w.findHolders(r, gs)
+	sizes := map[string]uint64{}
+	for _, kind := range []string{"sync.Mutex", "sync.RWMutex"} {
+		if t, err := typeOf(d, kind); err == nil {
+			sizes[kind] = uint64(t.Size())
+		}
+	}
+	w.findCodeHolders(u, gs, sizes)
+
+	sort.SliceStable(w.Objects, func(i, j int) bool {
+		return len(w.Objects[i].Waiters) > len(w.Objects[j].Waiters)
+	})
+	return w, nil
+}
+
+type semaWaiter struct {
+	addr, g uint64
+}
+
+// semaWaiters walks the treaps of semaphore addresses in runtime.semtable
+// and the lists of goroutines sleeping on each.
+func semaWaiters(r *MemReader, d *dwarf.Data, sudog dwarf.Type) ([]semaWaiter, error) {
+	table, err := GlobalValue(r, d, "runtime.semtable")
+	if err != nil {
+		return nil, err
+	}
+	var ws []semaWaiter
+	var walk func(s uint64, depth int)
+	walk = func(s uint64, depth int) {
+		if s == 0 || depth > 1024 || len(ws) >= maxWaiters {
+			return
+		}
+		v := NewValue(r, s, sudog)
+		addr := sudogPtr(v, "elem")
+		for l := s; l != 0 && len(ws) < maxWaiters; {
+			lv := NewValue(r, l, sudog)
+			ws = append(ws, semaWaiter{addr: addr, g: uintPath(lv, "g")})
+			l = uintPath(lv, "waitlink")
+		}
+		walk(uintPath(v, "prev"), depth+1)
+		walk(uintPath(v, "next"), depth+1)
+	}
+	n, _ := table.Len()
+	for i := uint64(0); i < n; i++ {
+		root, err := table.Index(i)
+		if err != nil {
+			return ws, err
+		}
+		walk(uintPath(root, "root", "treap"), 0)
+	}
+	return ws, nil
+}
+
+// sudogPtr reads a pointer of sudog, hidden from the GC in a
+// maybeTraceablePtr since Go 1.25.
+func sudogPtr(v Value, name string) uint64 {
+	for _, path := range [][]string{{name, "vu"}, {name, "maybeTraceablePtr", "vu"}, {name}} {
+		if f, err := v.Path(path...); err == nil {
+			if u, err := f.Uint(); err == nil {
+				return u
+			}
+		}
+	}
+	return 0
+}
+
+// objectState describes the lock or the channel.
+func objectState(r *MemReader, d *dwarf.Data, o *WaitObject) string {
+	if o.Addr == 0 {
+		return "nil"
+	}
+	switch o.Kind {
+	case "sync.Mutex":
+		t, err := typeOf(d, "sync.Mutex")
+		if err != nil {
+			return ""
+		}
+		return mutexState(NewValue(r, o.Addr, t))
+	case "sync.RWMutex":
+		t, err := typeOf(d, "sync.RWMutex")
+		if err != nil {
+			return ""
+		}
+		v := NewValue(r, o.Addr, t)
+		// readerCount is negative by rwmutexMaxReaders with a writer,
+		// which waits for readerWait readers to leave
+		readers := intPath(v, "readerCount")
+		switch {
+		case readers < 0 && intPath(v, "readerWait") > 0:
+			return fmt.Sprintf("writer waiting for %d readers", intPath(v, "readerWait"))
+		case readers < 0:
+			return "write locked"
+		case readers > 0:
+			return fmt.Sprintf("%d readers", readers)
+		}
+		return "unlocked"
+	case "chan":
+		t, err := typeOf(d, "runtime.hchan")
+		if err != nil {
+			return ""
+		}
+		v := NewValue(r, o.Addr, t)
+		state := fmt.Sprintf("len %d cap %d", uintPath(v, "qcount"), uintPath(v, "dataqsiz"))
+		if uintPath(v, "closed") != 0 {
+			state += " closed"
+		}
+		return state
+	}
+	return ""
+}
+
+func mutexState(v Value) string {
+	state := intPath(v, "mu", "state")
+	if !v.HasField("mu") {
+		state = intPath(v, "state")
+	}
+	s := "unlocked"
+	if state&1 != 0 {
+		s = "locked"
+	}
+	if state&4 != 0 {
+		s += " starving"
+	}
+	return s
+}
+
+// findHolders looks for the addresses of the objects on the used part of
+// the goroutine stacks.
+func (w *WaitGraph) findHolders(r *MemReader, gs []*Goroutine) {
+	byAddr := map[uint64][]*WaitObject{}
+	for _, o := range w.Objects {
+		if o.Addr != 0 {
+			byAddr[o.Addr] = append(byAddr[o.Addr], o)
+		}
+	}
+	if len(byAddr) == 0 {
+		return
+	}
+
+	ptr := uint64(r.PtrSize)
+	for _, g := range gs {
+		lo := g.Stack.Start
+		if len(g.Frames) > 0 && g.Frames[0].SP >= g.Stack.Start && g.Frames[0].SP < g.Stack.End {
+			lo = g.Frames[0].SP
+		}
+		if lo == 0 || g.Stack.End <= lo {
+			continue
+		}
+		lo &^= ptr - 1
+		b, err := r.Bytes(lo, int(g.Stack.End-lo))
+		if err != nil {
+			continue
+		}
+		seen := map[*WaitObject]bool{}
+		for off := uint64(0); off+ptr <= uint64(len(b)); off += ptr {
+			for _, o := range byAddr[r.word(b[off:])] {
+				if !seen[o] && !o.waits(g) {
+					seen[o] = true
+					o.Holders = append(o.Holders, g)
+				}
+			}
+		}
+	}
+}
+
+// findCodeHolders looks for the holders of the locks not found on
+// stacks, package-level variables, by the code of the goroutine frames:
+// a goroutine holds the lock if the last lockSite of it before the frame
+// PC takes the lock. A goroutine blocked on another lock is still in the
+// function which took this one, while the one which has not reached the
+// Lock yet is not a holder. The code is read in address order, not in
+// the order it ran.
+func (w *WaitGraph) findCodeHolders(u *Unwinder, gs []*Goroutine, sizes map[string]uint64) {
+	var objects []*WaitObject
+	for _, o := range w.Objects {
+		if o.Addr != 0 && o.Kind != "chan" && len(o.Holders) == 0 {
+			objects = append(objects, o)
+		}
+	}
+	if len(objects) == 0 {
+		return
+	}
+	objectAt := func(addr uint64) *WaitObject {
+		for _, o := range objects {
+			if addr >= o.Addr && addr < o.Addr+sizes[o.Kind] {
+				return o
+			}
+		}
+		return nil
+	}
+
+	sites := map[uint64][]lockSite{}
+	for _, g := range gs {
+		held := map[*WaitObject]bool{}
+		for _, fr := range g.Frames {
+			if fr.Inlined || fr.Entry == 0 {
+				continue
+			}
+			fs, ok := sites[fr.Entry]
+			if !ok {
+				fs = lockSites(u, fr.Entry)
+				sites[fr.Entry] = fs
+			}
+			last := map[*WaitObject]bool{}
+			for _, site := range fs {
+				if site.pc >= fr.LookupPC() {
+					break
+				}
+				if o := objectAt(site.addr); o != nil {
+					last[o] = site.acquire
+				}
+			}
+			for o, acquire := range last {
+				if acquire && !held[o] && !o.waits(g) {
+					held[o] = true
+					o.Holders = append(o.Holders, g)
+				}
+			}
+		}
+	}
+}
+
+// lockSite is an instruction taking or releasing the lock at addr.
+type lockSite struct {
+	pc, addr uint64
+	acquire  bool
+}
+
+// lockSites returns the instructions of the function at entry taking or
+// releasing locks by their addresses: LOCK CMPXCHG of the inlined
+// Mutex.Lock, LOCK XADD of a positive constant of the inlined RLock or
+// of a negative one of Unlock and RUnlock, and calls of the lock methods
+// with the address in the argument register. The addresses come from
+// RIP-relative operands on amd64 and absolute ones on 386 and are
+// followed through registers in a single pass ignoring branches.
+func lockSites(u *Unwinder, entry uint64) []lockSite {
+	f, ok := u.Tab.FuncForPC(entry)
+	if !ok || f.End <= entry {
+		return nil
+	}
+	code, err := u.R.Bytes(entry, int(f.End-entry))
+	if err != nil {
+		return nil
+	}
+	mode := 32
+	if u.R.PtrSize == 8 {
+		mode = 64
+	}
+
+	addrs := map[x86asm.Reg]uint64{}
+	consts := map[x86asm.Reg]int64{}
+	memAddr := func(a x86asm.Arg, next uint64) (uint64, bool) {
+		m, ok := a.(x86asm.Mem)
+		switch {
+		case !ok || m.Index != 0:
+			return 0, false
+		case m.Base == x86asm.RIP:
+			return next + uint64(m.Disp), true
+		case mode == 32 && m.Base == 0:
+			return uint64(uint32(m.Disp)), true
+		}
+		base, ok := addrs[fullReg(m.Base)]
+		return base + uint64(m.Disp), ok
+	}
+
+	var sites []lockSite
+	for pc := entry; len(code) > 0; {
+		inst, err := x86asm.Decode(code, mode)
+		if err != nil || inst.Len == 0 {
+			// skip the undecodable byte
+			code, pc = code[1:], pc+1
+			continue
+		}
+		next := pc + uint64(inst.Len)
+
+		locked := false
+		for _, p := range inst.Prefix {
+			locked = locked || p&0xff == x86asm.PrefixLOCK
+		}
+		dst, _ := inst.Args[0].(x86asm.Reg)
+		dst = fullReg(dst)
+
+		switch {
+		case inst.Op == x86asm.LEA:
+			delete(consts, dst)
+			if a, ok := memAddr(inst.Args[1], next); ok {
+				addrs[dst] = a
+			} else {
+				delete(addrs, dst)
+			}
+		case inst.Op == x86asm.MOV && dst != 0:
+			delete(addrs, dst)
+			if imm, ok := inst.Args[1].(x86asm.Imm); ok {
+				if inst.DataSize == 32 {
+					imm = x86asm.Imm(int32(imm))
+				}
+				consts[dst] = int64(imm)
+			} else {
+				delete(consts, dst)
+			}
+		case locked && inst.Op == x86asm.CMPXCHG:
+			if a, ok := memAddr(inst.Args[0], next); ok {
+				sites = append(sites, lockSite{pc: pc, addr: a, acquire: true})
+			}
+		case locked && inst.Op == x86asm.XADD:
+			src, _ := inst.Args[1].(x86asm.Reg)
+			c, ok := consts[fullReg(src)]
+			if a, ok2 := memAddr(inst.Args[0], next); ok && ok2 && c != 0 {
+				sites = append(sites, lockSite{pc: pc, addr: a, acquire: c > 0})
+			}
+			delete(consts, fullReg(src))
+		case inst.Op == x86asm.CALL:
+			if rel, ok := inst.Args[0].(x86asm.Rel); ok {
+				if fn, ok := u.Tab.FuncForPC(next + uint64(int64(rel))); ok {
+					for reg, a := range addrs {
+						if mode == 64 && reg != x86asm.RAX {
+							continue
+						}
+						if acquire, ok := lockFunc(fn.Name); ok {
+							sites = append(sites, lockSite{pc: pc, addr: a, acquire: acquire})
+						}
+					}
+				}
+			}
+			addrs = map[x86asm.Reg]uint64{}
+			consts = map[x86asm.Reg]int64{}
+		case dst != 0:
+			delete(addrs, dst)
+			delete(consts, dst)
+		}
+
+		code, pc = code[inst.Len:], next
+	}
+	return sites
+}
+
+// lockFunc reports whether the function takes or releases a lock.
+func lockFunc(name string) (acquire, ok bool) {
+	for _, suffix := range []string{").Lock", ").RLock", ").lockSlow", ".runtime_SemacquireRWMutexR", ".runtime_SemacquireRWMutex"} {
+		if strings.HasSuffix(name, suffix) {
+			return true, true
+		}
+	}
+	for _, suffix := range []string{").Unlock", ").RUnlock", ").unlockSlow", ").rUnlockSlow"} {
+		if strings.HasSuffix(name, suffix) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// fullReg returns the 64-bit register of the 16 and 32-bit ones.
+func fullReg(r x86asm.Reg) x86asm.Reg {
+	switch {
+	case r >= x86asm.AX && r <= x86asm.R15W:
+		return x86asm.RAX + (r - x86asm.AX)
+	case r >= x86asm.EAX && r <= x86asm.R15L:
+		return x86asm.RAX + (r - x86asm.EAX)
+	}
+	return r
+}
+
+func (o *WaitObject) waits(g *Goroutine) bool {
+	for _, waiter := range o.Waiters {
+		if waiter == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Cycles returns the groups of goroutines waiting for each other, the
+// strongly connected components of the graph of goroutines waiting on
+// objects held by other goroutines.
+func (w *WaitGraph) Cycles() [][]*Goroutine {
+	var waiting []*Goroutine
+	for g := range w.Waits {
+		waiting = append(waiting, g)
+	}
+	sort.Slice(waiting, func(i, j int) bool { return waiting[i].ID < waiting[j].ID })
+
+	// Tarjan's algorithm
+	index := map[*Goroutine]int{}
+	low := map[*Goroutine]int{}
+	onStack := map[*Goroutine]bool{}
+	var stack []*Goroutine
+	var cycles [][]*Goroutine
+	var visit func(g *Goroutine)
+	visit = func(g *Goroutine) {
+		index[g], low[g] = len(index), len(index)
+		stack = append(stack, g)
+		onStack[g] = true
+		for _, o := range w.Waits[g] {
+			for _, h := range o.Holders {
+				if _, ok := index[h]; !ok {
+					visit(h)
+					if low[h] < low[g] {
+						low[g] = low[h]
+					}
+				} else if onStack[h] && index[h] < low[g] {
+					low[g] = index[h]
+				}
+			}
+		}
+		if low[g] != index[g] {
+			return
+		}
+		var cycle []*Goroutine
+		for {
+			h := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[h] = false
+			cycle = append(cycle, h)
+			if h == g {
+				break
+			}
+		}
+		if len(cycle) > 1 {
+			sort.Slice(cycle, func(i, j int) bool { return cycle[i].ID < cycle[j].ID })
+			cycles = append(cycles, cycle)
+		}
+	}
+	for _, g := range waiting {
+		if _, ok := index[g]; !ok {
+			visit(g)
+		}
+	}
+	return cycles
+}
+
+// WaitLink is an object of a wait chain and its holder, nil if unknown.
+type WaitLink struct {
+	Object *WaitObject
+	Holder *Goroutine
+}
+
+// Chain follows the holders from the object: its holder, the object the
+// holder waits on, its holder and so on up to a goroutine which is not
+// blocked, an object without holders or a cycle. Blocked holders are
+// followed first. The last link of a cycle is the object seen before,
+// without a holder.
+func (w *WaitGraph) Chain(o *WaitObject) (chain []WaitLink, cycle bool) {
+	seen := map[*WaitObject]bool{}
+	for !seen[o] {
+		seen[o] = true
+		link := WaitLink{Object: o}
+		var next *WaitObject
+		for _, h := range o.Holders {
+			if link.Holder == nil {
+				link.Holder = h
+			}
+			if waits := w.Waits[h]; len(waits) > 0 {
+				link.Holder, next = h, waits[0]
+				break
+			}
+		}
+		chain = append(chain, link)
+		if next == nil {
+			return chain, false
+		}
+		o = next
+	}
+	return append(chain, WaitLink{Object: o}), true
+}
+
+// typeOf looks up the DWARF type by name.
+func typeOf(d *dwarf.Data, name string) (dwarf.Type, error) {
+	e, err := d.LookupEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.Type(e.Offset)
+}
+
+// fieldOffset returns the offset of the first field path found in the
+// struct type, 0 if none is.
+func fieldOffset(d *dwarf.Data, typ string, paths ...[]string) uint64 {
+	t, err := typeOf(d, typ)
+	if err != nil {
+		return 0
+	}
+	for _, path := range paths {
+		if f, err := NewValue(nil, 0, t).Path(path...); err == nil {
+			return f.Addr
+		}
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package elf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/debug/elf"
+)
+
+// DefaultDebugDir is the global debug directory searched by gdb.
+const DefaultDebugDir = "/usr/lib/debug"
+
+// GNUBuildID returns the hex encoded NT_GNU_BUILD_ID of the file.
+func GNUBuildID(f *elf.File) (string, error) {
+	notes, err := ReadAllNotes(f)
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range notes {
+		if n.Name == "GNU" && n.Type == NT_GNU_BUILD_ID {
+			return ReadGNUBuildID(n)
+		}
+	}
+
+	return "", errors.New("not found")
+}
+
+// GoBuildID returns the Go build id stored in the "Go" NT_GO_BUILD note.
+func GoBuildID(f *elf.File) (string, error) {
+	notes, err := ReadAllNotes(f)
+	if err != nil {
+		return "", err
+	}
+
+	for _, n := range notes {
+		if n.Name == "Go" && n.Type == NT_GO_BUILD {
+			return string(n.Data), nil
+		}
+	}
+
+	return "", errors.New("not found")
+}
+
+// ReadGNUDebugLink decodes the .gnu_debuglink section: NUL terminated
+// file name padded to 4 bytes followed by the CRC32 of the debug file.
+func ReadGNUDebugLink(f *elf.File) (name string, crc uint32, err error) {
+	s := f.Section(".gnu_debuglink")
+	if s == nil {
+		return "", 0, errors.New("not found")
+	}
+
+	data, err := s.Data()
+	if err != nil {
+		return "", 0, fmt.Errorf("read %v failed: %v", s.Name, err)
+	}
+
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", 0, fmt.Errorf("invalid %v: no file name terminator", s.Name)
+	}
+	off := (end + 4) &^ 3
+	if off+4 > len(data) {
+		return "", 0, fmt.Errorf("invalid %v: no crc", s.Name)
+	}
+
+	return string(data[:end]), f.ByteOrder.Uint32(data[off:]), nil
+}
+
+// HasDWARF reports whether the file carries its own debug info.
+func HasDWARF(f *elf.File) bool {
+	return f.Section(".debug_info") != nil || f.Section(".zdebug_info") != nil
+}
+
+// FindDebugFile looks for a separate debug file of the executable at path
+// the same way gdb does: first by NT_GNU_BUILD_ID in <dir>/.build-id/xx/yyyy.debug
+// and then by .gnu_debuglink in the directory of the executable, its .debug
+// subdirectory and <dir>/<executable dir>. The debug link candidates are
+// verified with CRC32. The dirs are searched in order, DefaultDebugDir is
+// always searched last.
+func FindDebugFile(f *elf.File, path string, dirs []string) (string, error) {
+	dirs = append(append([]string{}, dirs...), DefaultDebugDir)
+
+	if id, err := GNUBuildID(f); err == nil && len(id) > 2 {
+		for _, dir := range dirs {
+			candidate := filepath.Join(dir, ".build-id", id[:2], id[2:]+".debug")
+			if isFile(candidate) {
+				return candidate, nil
+			}
+		}
+	}
+
+	name, crc, err := ReadGNUDebugLink(f)
+	if err != nil {
+		return "", fmt.Errorf("no build-id match and no .gnu_debuglink: %v", err)
+	}
+
+	exe := path
+	if abs, err := filepath.Abs(path); err == nil {
+		exe = abs
+	}
+	exeDir := filepath.Dir(exe)
+
+	candidates := []string{
+		filepath.Join(exeDir, name),
+		filepath.Join(exeDir, ".debug", name),
+	}
+	for _, dir := range dirs {
+		candidates = append(candidates, filepath.Join(dir, exeDir, name), filepath.Join(dir, name))
+	}
+
+	for _, candidate := range candidates {
+		if candidate == exe || !isFile(candidate) {
+			continue
+		}
+		if sum, err := fileCRC32(candidate); err == nil && sum == crc {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("debug file %v (crc 0x%08x) not found", name, crc)
+}
+
+func isFile(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.Mode().IsRegular()
+}
+
+func fileCRC32(path string) (uint32, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, fd); err != nil {
+		return 0, err
+	}
+
+	return h.Sum32(), nil
+}
@@ -0,0 +1,249 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/debug/elf"
+)
+
+// ObjectStatus tells whether the file of an object mapped in a core is
+// found on this machine.
+type ObjectStatus int
+
+const (
+	ObjectFound ObjectStatus = iota
+	ObjectMissing
+	// ObjectMismatch means the files found have different build IDs.
+	ObjectMismatch
+)
+
+func (s ObjectStatus) String() string {
+	switch s {
+	case ObjectFound:
+		return "found"
+	case ObjectMissing:
+		return "missing"
+	case ObjectMismatch:
+		return "MISMATCH"
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
+// CoreObject is the executable or a shared object mapped by the process.
+type CoreObject struct {
+	// Name is the path of the file in NT_FILE.
+	Name string
+	// Start is the address the ELF header is mapped at.
+	Start uint64
+	// Main is set for the executable.
+	Main bool
+
+	// GNUBuildID and GoBuildID are read from the dumped memory, empty if
+	// the notes are not dumped.
+	GNUBuildID string
+	GoBuildID  string
+
+	Status ObjectStatus
+	// Path is the file found, or the last mismatching one.
+	Path string
+}
+
+// CoreObjects lists the ELF files mapped in the core by NT_FILE. Other
+// files (data, fonts, locales) are told apart by the ELF magic in the
+// dumped memory or, if it is not dumped, by an executable mapping.
+func CoreObjects(core *elf.File) ([]*CoreObject, error) {
+	notes, err := ReadAllNotes(core)
+	if err != nil {
+		return nil, err
+	}
+	var files []FileMapping
+	for _, n := range notes {
+		if n.Name == "CORE" && n.Type == NT_FILE {
+			if files, err = ReadFileNote(n, core.ByteOrder, core.Class); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if files == nil {
+		return nil, fmt.Errorf("no NT_FILE note")
+	}
+
+	// the executable has the program headers of AT_PHDR
+	var phdr uint64
+	if auxv, err := CoreAuxv(core); err == nil {
+		for _, a := range auxv {
+			if a.Tag == AT_PHDR {
+				phdr = a.Val
+			}
+		}
+	}
+
+	mem := NewProgMemory(core)
+	exec := map[string]bool{}
+	for _, f := range files {
+		if m := FindMapping(mem, f.Start); m != nil && m.Flags&elf.PF_X != 0 {
+			exec[f.Name] = true
+		}
+	}
+
+	var objs []*CoreObject
+	seen := map[string]bool{}
+	for i, f := range files {
+		if f.Off != 0 || seen[f.Name] {
+			continue
+		}
+		o := &CoreObject{Name: f.Name, Start: f.Start}
+
+		magic := make([]byte, len(elf.ELFMAG))
+		_, err := mem.ReadAt(magic, int64(f.Start))
+		switch {
+		case err == nil && string(magic) != elf.ELFMAG:
+			continue
+		case err != nil && !exec[f.Name]:
+			continue
+		}
+		seen[f.Name] = true
+
+		// the mappings of the file follow each other
+		for _, g := range files[i:] {
+			if g.Name != f.Name {
+				break
+			}
+			if phdr >= g.Start && phdr < g.End {
+				o.Main = true
+			}
+		}
+
+		if notes, err := MemoryNotes(mem, f.Start, core.ByteOrder, core.Class); err == nil {
+			for _, n := range notes {
+				switch {
+				case n.Name == "GNU" && n.Type == NT_GNU_BUILD_ID && o.GNUBuildID == "":
+					o.GNUBuildID, _ = ReadGNUBuildID(n)
+				case n.Name == "Go" && n.Type == NT_GO_BUILD && o.GoBuildID == "":
+					o.GoBuildID = string(n.Data)
+				}
+			}
+		}
+		if o.GNUBuildID == "" {
+			o.GNUBuildID = scanGNUBuildID(mem, f.Start, core.ByteOrder)
+		}
+		objs = append(objs, o)
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool { return objs[i].Main && !objs[j].Main })
+	return objs, nil
+}
+
+// scanGNUBuildID looks for NT_GNU_BUILD_ID in the first page of the file
+// mapped at start. The Go linker does not put it into PT_NOTE.
+func scanGNUBuildID(mem Memory, start uint64, o binary.ByteOrder) string {
+	page := make([]byte, 4096)
+	n, _ := mem.ReadAt(page, int64(start))
+	page = page[:n]
+
+	// namesz, descsz, type and the name
+	pattern := make([]byte, 8)
+	o.PutUint32(pattern, uint32(NT_GNU_BUILD_ID))
+	copy(pattern[4:], "GNU\x00")
+	for off := 0; off < len(page); {
+		k := bytes.Index(page[off:], pattern)
+		if k < 0 {
+			break
+		}
+		at := off + k - 8
+		off += k + 1
+		if at < 0 || at%4 != 0 || o.Uint32(page[at:]) != 4 {
+			continue
+		}
+		size := int(o.Uint32(page[at+4:]))
+		if size == 0 || at+16+size > len(page) {
+			continue
+		}
+		return hex.EncodeToString(page[at+16 : at+16+size])
+	}
+	return ""
+}
+
+// Find looks for the file of the object: at its path under sysroot (or
+// the root) and by the GNU build ID in <dir>/.build-id/xx/yyyy and the
+// debuginfod cache layout <dir>/<build id>/executable. The candidates are
+// verified by the build IDs known from the core.
+func (o *CoreObject) Find(sysroot string, dirs []string) {
+	root := sysroot
+	if root == "" {
+		root = "/"
+	}
+	candidates := []string{filepath.Join(root, o.Name)}
+	if id := o.GNUBuildID; len(id) > 2 {
+		for _, dir := range dirs {
+			candidates = append(candidates,
+				filepath.Join(dir, ".build-id", id[:2], id[2:]),
+				filepath.Join(dir, id, "executable"))
+		}
+	}
+
+	o.Status, o.Path = ObjectMissing, ""
+	for _, candidate := range candidates {
+		if !isFile(candidate) {
+			continue
+		}
+		ok, err := o.matches(candidate)
+		if err != nil {
+			continue
+		}
+		o.Path = candidate
+		if ok {
+			o.Status = ObjectFound
+			return
+		}
+		o.Status = ObjectMismatch
+	}
+}
+
+// matches compares the build IDs of the file with the known ones.
+func (o *CoreObject) matches(path string) (bool, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if o.GNUBuildID != "" {
+		if id, _ := GNUBuildID(f); id != o.GNUBuildID {
+			return false, nil
+		}
+	}
+	if o.GoBuildID != "" {
+		if id, _ := GoBuildID(f); id != o.GoBuildID {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// FindCoreExecutable returns the path of the executable of the core.
+func FindCoreExecutable(core *elf.File, sysroot string, dirs []string) (string, error) {
+	objs, err := CoreObjects(core)
+	if err != nil {
+		return "", err
+	}
+	for _, o := range objs {
+		if !o.Main {
+			continue
+		}
+		o.Find(sysroot, dirs)
+		switch o.Status {
+		case ObjectFound:
+			return o.Path, nil
+		case ObjectMismatch:
+			return "", fmt.Errorf("%v has a different build ID than the executable of the core", o.Path)
+		}
+		return "", fmt.Errorf("executable %v is not found", o.Name)
+	}
+	return "", fmt.Errorf("no executable in NT_FILE")
+}
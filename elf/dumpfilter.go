@@ -0,0 +1,167 @@
+package elf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+// DumpFilter selects the mappings written into cores by their kind, see
+// coredump_filter in core(5).
+type DumpFilter uint32
+
+const (
+	DumpAnonPrivate DumpFilter = 1 << iota
+	DumpAnonShared
+	DumpFilePrivate
+	DumpFileShared
+	DumpELFHeaders
+	DumpHugePrivate
+	DumpHugeShared
+	DumpDAXPrivate
+	DumpDAXShared
+)
+
+// DefaultDumpFilter is the default coredump_filter of Linux.
+const DefaultDumpFilter = DumpAnonPrivate | DumpAnonShared | DumpELFHeaders | DumpHugePrivate
+
+var dumpFilterStrings = []intName{
+	{uint32(DumpAnonPrivate), "anon-private"},
+	{uint32(DumpAnonShared), "anon-shared"},
+	{uint32(DumpFilePrivate), "file-private"},
+	{uint32(DumpFileShared), "file-shared"},
+	{uint32(DumpELFHeaders), "elf-headers"},
+	{uint32(DumpHugePrivate), "huge-private"},
+	{uint32(DumpHugeShared), "huge-shared"},
+	{uint32(DumpDAXPrivate), "dax-private"},
+	{uint32(DumpDAXShared), "dax-shared"},
+}
+
+func (f DumpFilter) String() string {
+	var s []string
+	for _, n := range dumpFilterStrings {
+		if uint32(f)&n.i != 0 {
+			s = append(s, n.s)
+		}
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ",")
+}
+
+// ParseDumpFilter accepts the hex bit mask of coredump_filter or a comma
+// separated list of names like "anon-private,elf-headers". If any name
+// is prefixed with '-', the list edits the default filter instead, e.g.
+// "-elf-headers,file-private".
+func ParseDumpFilter(s string) (DumpFilter, error) {
+	if x, err := strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 32); err == nil {
+		return DumpFilter(x), nil
+	}
+
+	var f DumpFilter
+	if strings.Contains(","+strings.Replace(s, " ", "", -1), ",-") {
+		f = DefaultDumpFilter
+	}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		remove := strings.HasPrefix(name, "-")
+		name = strings.TrimLeft(name, "+-")
+		if name == "" {
+			continue
+		}
+
+		bit := DumpFilter(0)
+		for _, n := range dumpFilterStrings {
+			if n.s == name {
+				bit = DumpFilter(n.i)
+			}
+		}
+		if name == "all" {
+			bit = 1<<uint(len(dumpFilterStrings)) - 1
+		}
+		if bit == 0 {
+			return 0, fmt.Errorf("unknown dump filter %q", name)
+		}
+
+		if remove {
+			f &^= bit
+		} else {
+			f |= bit
+		}
+	}
+
+	return f, nil
+}
+
+// DumpPolicy decides which memory of a process goes into its core.
+type DumpPolicy struct {
+	Filter DumpFilter
+	// SkipText leaves out the read-only private file mappings, i.e. code
+	// and constants that can be recovered from the files. ELF headers are
+	// still dumped if the filter has them.
+	SkipText bool
+	// Sparse leaves the pages of zeros as holes in the core file.
+	Sparse bool
+}
+
+func DefaultDumpPolicy() *DumpPolicy {
+	return &DumpPolicy{Filter: DefaultDumpFilter}
+}
+
+// DumpSize returns the number of bytes of the mapping to dump. The rules
+// follow vma_dump_size() of the kernel, the mappings not readable by the
+// process are not dumped. DAX mappings can not be told from /proc and are
+// treated as file mappings. mem is read for the ELF headers.
+func (p *DumpPolicy) DumpSize(m *Mapping, mem io.ReaderAt, pageSize uint64) uint64 {
+	f := p.Filter
+	whole := func(bit DumpFilter) uint64 {
+		if f&bit != 0 {
+			return m.Size()
+		}
+		return 0
+	}
+
+	// madvise(MADV_DONTDUMP), I/O and vsyscall pages
+	if m.Flags&elf.PF_R == 0 || m.HasVmFlag("dd") || m.HasVmFlag("io") || m.File == "[vvar]" || m.File == "[vvar_vclock]" {
+		return 0
+	}
+	if m.HasVmFlag("ht") {
+		if m.Shared {
+			return whole(DumpHugeShared)
+		}
+		return whole(DumpHugePrivate)
+	}
+	if m.Shared {
+		// shmem, memfd and unlinked files have no name to read them back
+		if !strings.HasPrefix(m.File, "/") || strings.HasSuffix(m.File, " (deleted)") || strings.HasPrefix(m.File, "/SYSV") || strings.HasPrefix(m.File, "/memfd:") {
+			return whole(DumpAnonShared)
+		}
+		return whole(DumpFileShared)
+	}
+	if !strings.HasPrefix(m.File, "/") {
+		return whole(DumpAnonPrivate)
+	}
+
+	// private file mappings with modified pages
+	if m.Anonymous > 0 && f&DumpAnonPrivate != 0 {
+		return m.Size()
+	}
+	if f&DumpFilePrivate != 0 && !(p.SkipText && m.Flags&elf.PF_W == 0) {
+		return m.Size()
+	}
+	if f&DumpELFHeaders != 0 && m.Off == 0 && mem != nil {
+		magic := make([]byte, len(elf.ELFMAG))
+		if _, err := mem.ReadAt(magic, int64(m.Start)); err == nil && bytes.Equal(magic, []byte(elf.ELFMAG)) {
+			if pageSize > m.Size() {
+				return m.Size()
+			}
+			return pageSize
+		}
+	}
+	return 0
+}
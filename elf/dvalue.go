@@ -0,0 +1,192 @@
+package elf
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// Value is a DWARF typed variable in the process memory giving access to
+// the runtime structures without hardcoding their layout.
+type Value struct {
+	Addr uint64
+	Type dwarf.Type
+
+	r *MemReader
+}
+
+func NewValue(r *MemReader, addr uint64, t dwarf.Type) Value {
+	return Value{Addr: addr, Type: t, r: r}
+}
+
+// GlobalValue looks up the global variable by name.
+func GlobalValue(r *MemReader, d *dwarf.Data, name string) (Value, error) {
+	e, err := d.LookupVariable(name)
+	if err != nil {
+		return Value{}, err
+	}
+	addr, err := d.EntryLocation(e)
+	if err != nil {
+		return Value{}, fmt.Errorf("%v: %v", name, err)
+	}
+	t, err := d.EntryType(e)
+	if err != nil {
+		return Value{}, fmt.Errorf("%v: %v", name, err)
+	}
+	return NewValue(r, addr, t), nil
+}
+
+// AttrGoRuntimeType is DW_AT_go_runtime_type of the Go linker.
+const AttrGoRuntimeType dwarf.Attr = 0x2904
+
+// RuntimeTypes maps the runtime type descriptors to the DWARF types by
+// DW_AT_go_runtime_type. The linkers of Go 1.22 and later write it
+// relative to the module types, the older ones as the address.
+func RuntimeTypes(d *dwarf.Data, types uint64) (map[uint64]dwarf.Offset, error) {
+	m := map[uint64]dwarf.Offset{}
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return m, nil
+		}
+		addr, ok := e.Val(AttrGoRuntimeType).(uint64)
+		if !ok || addr == 0 {
+			continue
+		}
+		if addr < types {
+			addr += types
+		}
+		m[addr] = e.Offset
+	}
+}
+
+// HasField reports whether the struct (or the struct pointed to) has the field.
+func (v Value) HasField(name string) bool {
+	return field(v.Type, name) != nil
+}
+
+// Field returns the struct field, dereferencing a pointer to the struct.
+func (v Value) Field(name string) (Value, error) {
+	if p, ok := under(v.Type).(*dwarf.PtrType); ok {
+		addr, err := v.r.Ptr(v.Addr)
+		if err != nil {
+			return Value{}, err
+		}
+		v = NewValue(v.r, addr, p.Type)
+	}
+
+	f := field(v.Type, name)
+	if f == nil {
+		return Value{}, fmt.Errorf("no field %v in %v", name, v.Type)
+	}
+	return NewValue(v.r, v.Addr+uint64(f.ByteOffset), f.Type), nil
+}
+
+// Path follows the chain of fields.
+func (v Value) Path(names ...string) (Value, error) {
+	var err error
+	for _, name := range names {
+		if v, err = v.Field(name); err != nil {
+			return Value{}, err
+		}
+	}
+	return v, nil
+}
+
+// Uint reads an integer, boolean or pointer. Structs wrapping a single
+// value such as atomic.Uint64 are unwrapped.
+func (v Value) Uint() (uint64, error) {
+	t := under(v.Type)
+	if st, ok := t.(*dwarf.StructType); ok {
+		var inner *dwarf.StructField
+		for _, f := range st.Field {
+			if f.Type.Size() == 0 {
+				continue
+			}
+			if inner != nil {
+				return 0, fmt.Errorf("%v is not an integer", v.Type)
+			}
+			inner = f
+		}
+		if inner == nil {
+			return 0, fmt.Errorf("%v is not an integer", v.Type)
+		}
+		return NewValue(v.r, v.Addr+uint64(inner.ByteOffset), inner.Type).Uint()
+	}
+
+	size := int(t.Size())
+	if size <= 0 || size > 8 {
+		return 0, fmt.Errorf("%v is not an integer", v.Type)
+	}
+	return v.r.Uint(v.Addr, size)
+}
+
+// Int reads a signed integer.
+func (v Value) Int() (int64, error) {
+	u, err := v.Uint()
+	if err != nil {
+		return 0, err
+	}
+	shift := uint(64 - 8*under(v.Type).Size())
+	if shift >= 64 {
+		return int64(u), nil
+	}
+	return int64(u<<shift) >> shift, nil
+}
+
+// Elem dereferences a pointer.
+func (v Value) Elem() (Value, error) {
+	p, ok := under(v.Type).(*dwarf.PtrType)
+	if !ok {
+		return Value{}, fmt.Errorf("%v is not a pointer", v.Type)
+	}
+	addr, err := v.r.Ptr(v.Addr)
+	if err != nil {
+		return Value{}, err
+	}
+	if addr == 0 {
+		return Value{}, fmt.Errorf("nil %v", v.Type)
+	}
+	return NewValue(v.r, addr, p.Type), nil
+}
+
+// Len returns the length of an array, slice or string.
+func (v Value) Len() (uint64, error) {
+	switch t := under(v.Type).(type) {
+	case *dwarf.ArrayType:
+		return uint64(t.Count), nil
+	case *dwarf.SliceType:
+		h, err := v.r.Slice(v.Addr)
+		return h.Len, err
+	case *dwarf.StringType:
+		return v.r.Ptr(v.Addr + uint64(v.r.PtrSize))
+	}
+	return 0, fmt.Errorf("%v has no length", v.Type)
+}
+
+// Index returns the element of an array or slice.
+func (v Value) Index(i uint64) (Value, error) {
+	switch t := under(v.Type).(type) {
+	case *dwarf.ArrayType:
+		return NewValue(v.r, v.Addr+i*uint64(t.Type.Size()), t.Type), nil
+	case *dwarf.SliceType:
+		h, err := v.r.Slice(v.Addr)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewValue(v.r, h.Data+i*uint64(t.ElemType.Size()), t.ElemType), nil
+	}
+	return Value{}, fmt.Errorf("%v can not be indexed", v.Type)
+}
+
+// String reads a Go string of at most limit bytes.
+func (v Value) String(limit int) (string, error) {
+	if _, ok := under(v.Type).(*dwarf.StringType); !ok {
+		return "", fmt.Errorf("%v is not a string", v.Type)
+	}
+	return v.r.String(v.Addr, limit)
+}
@@ -0,0 +1,516 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// DWARF forms and attributes the vendored reader predates.
+const (
+	formAddr        = 0x01
+	formBlock2      = 0x03
+	formBlock4      = 0x04
+	formData2       = 0x05
+	formData4       = 0x06
+	formData8       = 0x07
+	formString      = 0x08
+	formBlock       = 0x09
+	formBlock1      = 0x0a
+	formData1       = 0x0b
+	formFlag        = 0x0c
+	formSdata       = 0x0d
+	formStrp        = 0x0e
+	formUdata       = 0x0f
+	formRefAddr     = 0x10
+	formRef1        = 0x11
+	formRef2        = 0x12
+	formRef4        = 0x13
+	formRef8        = 0x14
+	formRefUdata    = 0x15
+	formIndirect    = 0x16
+	formSecOffset   = 0x17
+	formExprloc     = 0x18
+	formFlagPresent = 0x19
+	formStrx        = 0x1a
+	formAddrx       = 0x1b
+	formData16      = 0x1e
+	formLineStrp    = 0x1f
+	formRefSig8     = 0x20
+	formImplicit    = 0x21
+	formLoclistx    = 0x22
+	formRnglistx    = 0x23
+	formStrx1       = 0x25
+	formStrx4       = 0x28
+	formAddrx1      = 0x29
+	formAddrx4      = 0x2c
+	formGnuRefAlt   = 0x1f20
+	formGnuStrpAlt  = 0x1f21
+
+	attrStrOffsBase = 0x72
+	attrAddrBase    = 0x73
+
+	unitCompile      = 0x01
+	unitType         = 0x02
+	unitPartial      = 0x03
+	unitSkeleton     = 0x04
+	unitSplitCompile = 0x05
+	unitSplitType    = 0x06
+)
+
+// dwarf5 holds the sections a DWARF 5 .debug_info refers to.
+type dwarf5 struct {
+	abbrev, info, str         []byte
+	strOffsets, addr, lineStr []byte
+}
+
+type abbrevAttr struct {
+	attr, form uint64
+	implicit   int64
+}
+
+type abbrevDecl struct {
+	tag      uint64
+	children uint8
+	attrs    []abbrevAttr
+}
+
+// dwarf5Unit is the state of the unit being rewritten.
+type dwarf5Unit struct {
+	vers, asize    int
+	base, newBase  int
+	strOffs, addrs uint64
+	abbrevs        map[uint64]*abbrevDecl
+	dry            bool
+}
+
+type dwarf5Fixup struct {
+	pos, base int
+	target    uint64
+}
+
+type dwarf5Writer struct {
+	d      *dwarf5
+	order  binary.ByteOrder
+	abbrev []byte
+	info   []byte
+	tables map[uint64]uint64
+	decls  map[uint64]map[uint64]*abbrevDecl
+	dies   map[uint64]uint64
+	fixups []dwarf5Fixup
+}
+
+// hasDWARF5 reports whether any unit of .debug_info is of version 5.
+func hasDWARF5(info []byte, o binary.ByteOrder) bool {
+	for off := 0; off+6 <= len(info); {
+		n := int(o.Uint32(info[off:]))
+		if n == 0xffffffff {
+			return false
+		}
+		if o.Uint16(info[off+4:]) == 5 {
+			return true
+		}
+		off += 4 + n
+	}
+	return false
+}
+
+// downgrade rewrites .debug_info and .debug_abbrev of DWARF 5 into DWARF
+// 4 encodings golang.org/x/debug/dwarf decodes: unit headers lose the unit
+// type, strx and addrx are resolved through .debug_str_offsets and
+// .debug_addr, .debug_line_str is appended to the returned .debug_str,
+// implicit constants move into the entries and references are renumbered.
+// Type units are dropped, 64-bit DWARF is not supported.
+func (d *dwarf5) downgrade(o binary.ByteOrder) (abbrev, info, str []byte, err error) {
+	if uint64(len(d.str))+uint64(len(d.lineStr)) > 0xffffffff {
+		return nil, nil, nil, errors.New("string sections exceed 4 GiB")
+	}
+
+	w := &dwarf5Writer{
+		d:      d,
+		order:  o,
+		tables: make(map[uint64]uint64),
+		decls:  make(map[uint64]map[uint64]*abbrevDecl),
+		dies:   make(map[uint64]uint64),
+	}
+	for off := 0; off < len(d.info); {
+		n, err := w.unit(off)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("unit at 0x%x: %v", off, err)
+		}
+		off += n
+	}
+
+	for _, f := range w.fixups {
+		to, ok := w.dies[f.target]
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("reference to 0x%x is not an entry", f.target)
+		}
+		o.PutUint32(w.info[f.pos:], uint32(to-uint64(f.base)))
+	}
+
+	str = make([]byte, 0, len(d.str)+len(d.lineStr))
+	str = append(append(str, d.str...), d.lineStr...)
+	return w.abbrev, w.info, str, nil
+}
+
+// unit rewrites the unit at off and returns its size in the input.
+func (w *dwarf5Writer) unit(off int) (int, error) {
+	b := &lineBuf{data: w.d.info[off:], order: w.order}
+	n := int(b.u32())
+	if n == 0xffffffff {
+		return 0, errors.New("64-bit DWARF is not supported")
+	}
+	if b.err != nil || n > len(b.data) {
+		return 0, errors.New("unit length out of bounds")
+	}
+	b.data = b.data[:n]
+
+	u := &dwarf5Unit{vers: int(b.u16()), base: off, strOffs: 8, addrs: 8}
+	var table uint64
+	switch u.vers {
+	case 2, 3, 4:
+		table = uint64(b.u32())
+		u.asize = int(b.u8())
+	case 5:
+		typ := b.u8()
+		u.asize = int(b.u8())
+		table = uint64(b.u32())
+		switch typ {
+		case unitCompile, unitPartial:
+		case unitSkeleton, unitSplitCompile:
+			b.u64()
+		case unitType, unitSplitType:
+			return 4 + n, nil
+		default:
+			return 0, fmt.Errorf("unknown unit type 0x%x", typ)
+		}
+	default:
+		return 0, fmt.Errorf("unsupported DWARF version %d", u.vers)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	var err error
+	if u.abbrevs, err = w.abbrevTable(table); err != nil {
+		return 0, err
+	}
+
+	// The bases may come after the attributes using them.
+	dry := *b
+	u.dry = true
+	if err := w.entry(&dry, u, nil); err != nil {
+		return 0, err
+	}
+	u.dry = false
+
+	u.newBase = len(w.info)
+	w.info = appendUint32(w.order, w.info, 0)
+	w.info = appendUint16(w.order, w.info, 4)
+	w.info = appendUint32(w.order, w.info, uint32(w.tables[table]))
+	w.info = append(w.info, uint8(u.asize))
+
+	for len(b.data) > 0 {
+		start := uint64(off + 4 + n - len(b.data))
+		w.dies[start] = uint64(len(w.info))
+		if err := w.entry(b, u, &w.info); err != nil {
+			return 0, fmt.Errorf("entry at 0x%x: %v", start, err)
+		}
+	}
+	w.order.PutUint32(w.info[u.newBase:], uint32(len(w.info)-u.newBase-4))
+
+	return 4 + n, nil
+}
+
+// abbrevTable parses the abbreviations at off and writes them out with
+// the forms they are rewritten to.
+func (w *dwarf5Writer) abbrevTable(off uint64) (map[uint64]*abbrevDecl, error) {
+	if m, ok := w.decls[off]; ok {
+		return m, nil
+	}
+	if off > uint64(len(w.d.abbrev)) {
+		return nil, fmt.Errorf("abbreviation table 0x%x out of bounds", off)
+	}
+
+	w.tables[off] = uint64(len(w.abbrev))
+	m := make(map[uint64]*abbrevDecl)
+	b := &lineBuf{data: w.d.abbrev[off:], order: w.order}
+	for {
+		code := b.uleb()
+		w.abbrev = appendULEB(w.abbrev, code)
+		if code == 0 || b.err != nil {
+			break
+		}
+
+		a := &abbrevDecl{tag: b.uleb(), children: b.u8()}
+		w.abbrev = appendULEB(w.abbrev, a.tag)
+		w.abbrev = append(w.abbrev, a.children)
+		for {
+			at := abbrevAttr{attr: b.uleb(), form: b.uleb()}
+			if at.form == formImplicit {
+				at.implicit = b.sleb()
+			}
+			if at.attr == 0 && at.form == 0 || b.err != nil {
+				break
+			}
+			form, err := downgradeForm(at.form)
+			if err != nil {
+				return nil, err
+			}
+			a.attrs = append(a.attrs, at)
+			w.abbrev = appendULEB(w.abbrev, at.attr)
+			w.abbrev = appendULEB(w.abbrev, form)
+		}
+		w.abbrev = append(w.abbrev, 0, 0)
+		m[code] = a
+	}
+	if b.err != nil {
+		return nil, fmt.Errorf("abbreviation table 0x%x: %v", off, b.err)
+	}
+
+	w.decls[off] = m
+	return m, nil
+}
+
+// downgradeForm returns the DWARF 4 form the values of form are written in.
+func downgradeForm(form uint64) (uint64, error) {
+	switch {
+	case form == formStrx || form == formLineStrp || form >= formStrx1 && form <= formStrx4:
+		return formStrp, nil
+	case form == formAddrx || form >= formAddrx1 && form <= formAddrx4:
+		return formAddr, nil
+	case form == formImplicit:
+		return formSdata, nil
+	case form == formData16:
+		return formBlock1, nil
+	case form == formLoclistx || form == formRnglistx:
+		return formUdata, nil
+	case form == formRef1 || form == formRef2 || form == formRef8 || form == formRefUdata:
+		return formRef4, nil
+	case form <= 0x20 || form == formGnuRefAlt || form == formGnuStrpAlt:
+		return form, nil
+	}
+	return 0, fmt.Errorf("unsupported form 0x%x", form)
+}
+
+// entry rewrites a single entry into out. A nil out only reads the
+// string and address bases of the unit.
+func (w *dwarf5Writer) entry(b *lineBuf, u *dwarf5Unit, out *[]byte) error {
+	var sink []byte
+	if out == nil {
+		out = &sink
+	}
+
+	code := b.uleb()
+	*out = appendULEB(*out, code)
+	if code == 0 {
+		return b.err
+	}
+	a, ok := u.abbrevs[code]
+	if !ok {
+		return fmt.Errorf("unknown abbreviation %d", code)
+	}
+
+	for _, at := range a.attrs {
+		form := at.form
+		if form == formIndirect {
+			form = b.uleb()
+			to, err := downgradeForm(form)
+			if err != nil {
+				return err
+			}
+			*out = appendULEB(*out, to)
+		}
+
+		v := b.data
+		if err := w.value(b, u, form, at.implicit, out); err != nil {
+			return err
+		}
+		if u.dry && (at.attr == attrStrOffsBase || at.attr == attrAddrBase) {
+			vb := &lineBuf{data: v, order: w.order}
+			base := vb.uint(formSize(form))
+			if at.attr == attrStrOffsBase {
+				u.strOffs = base
+			} else {
+				u.addrs = base
+			}
+		}
+	}
+
+	return b.err
+}
+
+// formSize is the size of the fixed size forms the bases are given in.
+func formSize(form uint64) int {
+	switch form {
+	case formData1:
+		return 1
+	case formData2:
+		return 2
+	case formData8:
+		return 8
+	}
+	return 4
+}
+
+// value rewrites the value of an attribute of the form.
+func (w *dwarf5Writer) value(b *lineBuf, u *dwarf5Unit, form uint64, implicit int64, out *[]byte) error {
+	o := w.order
+	copyN := func(n int) { *out = append(*out, b.bytes(n)...) }
+	copyLEB := func() {
+		v := b.data
+		b.uleb()
+		*out = append(*out, v[:len(v)-len(b.data)]...)
+	}
+
+	switch form {
+	case formAddr:
+		copyN(u.asize)
+	case formBlock2:
+		n := b.u16()
+		*out = appendUint16(o, *out, n)
+		copyN(int(n))
+	case formBlock4:
+		n := b.u32()
+		*out = appendUint32(o, *out, n)
+		copyN(int(n))
+	case formBlock, formExprloc:
+		n := b.uleb()
+		*out = appendULEB(*out, n)
+		copyN(int(n))
+	case formBlock1:
+		n := b.u8()
+		*out = append(*out, n)
+		copyN(int(n))
+	case formData1, formFlag:
+		copyN(1)
+	case formData2:
+		copyN(2)
+	case formData4, formStrp, formSecOffset, formGnuRefAlt, formGnuStrpAlt:
+		copyN(4)
+	case formData8, formRefSig8:
+		copyN(8)
+	case formSdata, formUdata, formLoclistx, formRnglistx:
+		copyLEB()
+	case formString:
+		for c := uint8(1); c != 0 && b.err == nil; {
+			c = b.u8()
+			*out = append(*out, c)
+		}
+	case formFlagPresent:
+	case formImplicit:
+		*out = appendSLEB(*out, implicit)
+	case formData16:
+		*out = append(*out, 16)
+		copyN(16)
+
+	case formRefAddr:
+		size := 4
+		if u.vers == 2 {
+			size = u.asize
+		}
+		w.ref(b.uint(size), 0, out, u)
+	case formRef1:
+		w.ref(uint64(u.base)+uint64(b.u8()), u.newBase, out, u)
+	case formRef2:
+		w.ref(uint64(u.base)+uint64(b.u16()), u.newBase, out, u)
+	case formRef4:
+		w.ref(uint64(u.base)+uint64(b.u32()), u.newBase, out, u)
+	case formRef8:
+		w.ref(uint64(u.base)+b.u64(), u.newBase, out, u)
+	case formRefUdata:
+		w.ref(uint64(u.base)+b.uleb(), u.newBase, out, u)
+
+	case formLineStrp:
+		*out = appendUint32(o, *out, uint32(len(w.d.str))+b.u32())
+	case formStrx, formStrx1, formStrx1 + 1, formStrx1 + 2, formStrx4:
+		i := w.index(b, form-formStrx1+1, form == formStrx)
+		var off uint32
+		if !u.dry {
+			p := u.strOffs + i*4
+			if p+4 > uint64(len(w.d.strOffsets)) {
+				return fmt.Errorf("string index %d out of bounds", i)
+			}
+			off = o.Uint32(w.d.strOffsets[p:])
+		}
+		*out = appendUint32(o, *out, off)
+	case formAddrx, formAddrx1, formAddrx1 + 1, formAddrx1 + 2, formAddrx4:
+		i := w.index(b, form-formAddrx1+1, form == formAddrx)
+		addr := make([]byte, u.asize)
+		if !u.dry {
+			p := u.addrs + i*uint64(u.asize)
+			if p+uint64(u.asize) > uint64(len(w.d.addr)) {
+				return fmt.Errorf("address index %d out of bounds", i)
+			}
+			copy(addr, w.d.addr[p:])
+		}
+		*out = append(*out, addr...)
+
+	default:
+		return fmt.Errorf("unsupported form 0x%x", form)
+	}
+
+	return b.err
+}
+
+// index reads a strx or addrx index of n bytes or as ULEB128.
+func (w *dwarf5Writer) index(b *lineBuf, n uint64, leb bool) uint64 {
+	if leb {
+		return b.uleb()
+	}
+	if n == 3 {
+		p := b.bytes(3)
+		if w.order == binary.BigEndian {
+			return uint64(p[0])<<16 | uint64(p[1])<<8 | uint64(p[2])
+		}
+		return uint64(p[2])<<16 | uint64(p[1])<<8 | uint64(p[0])
+	}
+	return b.uint(int(n))
+}
+
+// ref writes a 4 byte reference to the entry at the input offset target,
+// relative to base, to be resolved once all entries are placed.
+func (w *dwarf5Writer) ref(target uint64, base int, out *[]byte, u *dwarf5Unit) {
+	if !u.dry {
+		w.fixups = append(w.fixups, dwarf5Fixup{pos: len(*out), base: base, target: target})
+	}
+	*out = appendUint32(w.order, *out, 0)
+}
+
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := uint8(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func appendSLEB(b []byte, v int64) []byte {
+	for {
+		c := uint8(v & 0x7f)
+		v >>= 7
+		if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func appendUint16(o binary.ByteOrder, b []byte, v uint16) []byte {
+	var p [2]byte
+	o.PutUint16(p[:], v)
+	return append(b, p[:]...)
+}
+
+func appendUint32(o binary.ByteOrder, b []byte, v uint32) []byte {
+	var p [4]byte
+	o.PutUint32(p[:], v)
+	return append(b, p[:]...)
+}
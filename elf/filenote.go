@@ -0,0 +1,86 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/debug/elf"
+)
+
+// FileMapping is an entry of NT_FILE, a file mapped into the process.
+type FileMapping struct {
+	Start, End uint64
+	// Off is the offset in the file in bytes.
+	Off  uint64
+	Name string
+}
+
+// EncodeFileNote encodes NT_FILE: the number of entries and the page
+// size, start, end and offset in pages of every entry, then their names.
+func EncodeFileNote(files []FileMapping, pageSize uint64, o binary.ByteOrder, c elf.Class) ([]byte, error) {
+	if pageSize == 0 {
+		return nil, errors.New("invalid page size")
+	}
+
+	b := &bytes.Buffer{}
+	if err := writeUInt(b, o, c, uint64(len(files))); err != nil {
+		return nil, err
+	}
+	writeUInt(b, o, c, pageSize)
+	for _, f := range files {
+		writeUInt(b, o, c, f.Start)
+		writeUInt(b, o, c, f.End)
+		writeUInt(b, o, c, f.Off/pageSize)
+	}
+	for _, f := range files {
+		b.WriteString(f.Name)
+		b.WriteByte(0)
+	}
+
+	return b.Bytes(), nil
+}
+
+// ReadFileNote decodes NT_FILE.
+func ReadFileNote(n *Note, o binary.ByteOrder, c elf.Class) ([]FileMapping, error) {
+	if n.Type != NT_FILE {
+		return nil, fmt.Errorf("invalid note type: %v", n)
+	}
+
+	r := n.Open()
+	count, err := readUInt(r, o, c)
+	if err != nil {
+		return nil, fmt.Errorf("read count failed: %v", err)
+	}
+	pageSize, err := readUInt(r, o, c)
+	if err != nil {
+		return nil, fmt.Errorf("read page size failed: %v", err)
+	}
+	if uint64(count) > uint64(len(n.Data)) {
+		return nil, fmt.Errorf("invalid count %d", count)
+	}
+
+	files := make([]FileMapping, count)
+	for i := range files {
+		var x [3]uint
+		for j := range x {
+			if x[j], err = readUInt(r, o, c); err != nil {
+				return nil, fmt.Errorf("read entry %d failed: %v", i, err)
+			}
+		}
+		files[i] = FileMapping{Start: uint64(x[0]), End: uint64(x[1]), Off: uint64(x[2]) * uint64(pageSize)}
+	}
+
+	pos, _ := r.Seek(0, io.SeekCurrent)
+	names := bytes.Split(n.Data[pos:], []byte{0})
+	if len(names) < len(files) {
+		return nil, errors.New("missing file names")
+	}
+	for i := range files {
+		files[i].Name = string(names[i])
+	}
+
+	return files, nil
+}
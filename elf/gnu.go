@@ -0,0 +1,285 @@
+package elf
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+// http://lxr.free-electrons.com/source/include/uapi/linux/elf.h
+// https://github.com/hjl-tools/linux-abi/wiki/Linux-Extensions-to-gABI
+const (
+	NT_GNU_ABI_TAG         NoteType = 0x1
+	NT_GNU_HWCAP           NoteType = 0x2
+	NT_GNU_BUILD_ID        NoteType = 0x3
+	NT_GNU_GOLD_VERSION    NoteType = 0x4
+	NT_GNU_PROPERTY_TYPE_0 NoteType = 0x5
+)
+
+var gnuNoteStrings = []intName{
+	{0x1, "NT_GNU_ABI_TAG"},
+	{0x2, "NT_GNU_HWCAP"},
+	{0x3, "NT_GNU_BUILD_ID"},
+	{0x4, "NT_GNU_GOLD_VERSION"},
+	{0x5, "NT_GNU_PROPERTY_TYPE_0"},
+}
+
+// ReadGNUBuildID returns the hex encoded build id of the NT_GNU_BUILD_ID note.
+func ReadGNUBuildID(n *Note) (string, error) {
+	if n.Name != "GNU" || n.Type != NT_GNU_BUILD_ID {
+		return "", fmt.Errorf("invalid note type: %v/%v", n.Name, n.TypeString())
+	}
+
+	return hex.EncodeToString(n.Data), nil
+}
+
+type GNUABIOS uint32
+
+const (
+	ELF_NOTE_OS_LINUX    GNUABIOS = 0
+	ELF_NOTE_OS_GNU      GNUABIOS = 1
+	ELF_NOTE_OS_SOLARIS2 GNUABIOS = 2
+	ELF_NOTE_OS_FREEBSD  GNUABIOS = 3
+)
+
+var gnuABIOSStrings = []intName{
+	{0, "Linux"},
+	{1, "GNU"},
+	{2, "Solaris2"},
+	{3, "FreeBSD"},
+}
+
+func (i GNUABIOS) String() string { return stringName(uint32(i), gnuABIOSStrings, false) }
+
+// GNUABITag describes the minimal kernel version the object is built for.
+type GNUABITag struct {
+	OS       GNUABIOS
+	Major    uint32
+	Minor    uint32
+	SubMinor uint32
+}
+
+func (t GNUABITag) String() string {
+	return fmt.Sprintf("OS: %v, ABI: %d.%d.%d", t.OS, t.Major, t.Minor, t.SubMinor)
+}
+
+func ReadGNUABITag(n *Note, o binary.ByteOrder) (*GNUABITag, error) {
+	if n.Name != "GNU" || n.Type != NT_GNU_ABI_TAG {
+		return nil, fmt.Errorf("invalid note type: %v/%v", n.Name, n.TypeString())
+	}
+
+	tag := &GNUABITag{}
+	if err := binary.Read(n.Open(), o, tag); err != nil {
+		return nil, fmt.Errorf("read abi tag failed: %v", err)
+	}
+
+	return tag, nil
+}
+
+type GNUPropertyType uint32
+
+const (
+	GNU_PROPERTY_STACK_SIZE            GNUPropertyType = 1
+	GNU_PROPERTY_NO_COPY_ON_PROTECTED  GNUPropertyType = 2
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND GNUPropertyType = 0xc0000000
+	GNU_PROPERTY_X86_ISA_1_USED        GNUPropertyType = 0xc0010002
+	GNU_PROPERTY_X86_ISA_1_NEEDED      GNUPropertyType = 0xc0008002
+	GNU_PROPERTY_X86_FEATURE_1_AND     GNUPropertyType = 0xc0000002
+	GNU_PROPERTY_X86_FEATURE_2_USED    GNUPropertyType = 0xc0010001
+)
+
+var gnuPropertyStrings = []intName{
+	{1, "GNU_PROPERTY_STACK_SIZE"},
+	{2, "GNU_PROPERTY_NO_COPY_ON_PROTECTED"},
+	{0xc0000000, "GNU_PROPERTY_AARCH64_FEATURE_1_AND"},
+	{0xc0000002, "GNU_PROPERTY_X86_FEATURE_1_AND"},
+	{0xc0008002, "GNU_PROPERTY_X86_ISA_1_NEEDED"},
+	{0xc0010001, "GNU_PROPERTY_X86_FEATURE_2_USED"},
+	{0xc0010002, "GNU_PROPERTY_X86_ISA_1_USED"},
+}
+
+func (i GNUPropertyType) String() string {
+	for _, n := range gnuPropertyStrings {
+		if n.i == uint32(i) {
+			return n.s
+		}
+	}
+	return fmt.Sprintf("0x%x", uint32(i))
+}
+
+const (
+	GNU_PROPERTY_X86_FEATURE_1_IBT   = 0x1
+	GNU_PROPERTY_X86_FEATURE_1_SHSTK = 0x2
+
+	GNU_PROPERTY_AARCH64_FEATURE_1_BTI = 0x1
+	GNU_PROPERTY_AARCH64_FEATURE_1_PAC = 0x2
+)
+
+var x86Feature1Strings = []intName{
+	{GNU_PROPERTY_X86_FEATURE_1_IBT, "IBT"},
+	{GNU_PROPERTY_X86_FEATURE_1_SHSTK, "SHSTK"},
+}
+
+var x86ISA1Strings = []intName{
+	{0x1, "x86-64-baseline"},
+	{0x2, "x86-64-v2"},
+	{0x4, "x86-64-v3"},
+	{0x8, "x86-64-v4"},
+}
+
+var aarch64Feature1Strings = []intName{
+	{GNU_PROPERTY_AARCH64_FEATURE_1_BTI, "BTI"},
+	{GNU_PROPERTY_AARCH64_FEATURE_1_PAC, "PAC"},
+}
+
+// GNUProperty is a single entry of the NT_GNU_PROPERTY_TYPE_0 note.
+type GNUProperty struct {
+	Type GNUPropertyType
+	Data []byte
+
+	order binary.ByteOrder
+}
+
+func (p GNUProperty) String() string {
+	switch p.Type {
+	case GNU_PROPERTY_X86_FEATURE_1_AND:
+		return p.Type.String() + ": " + p.flags(x86Feature1Strings)
+	case GNU_PROPERTY_X86_ISA_1_USED, GNU_PROPERTY_X86_ISA_1_NEEDED:
+		return p.Type.String() + ": " + p.flags(x86ISA1Strings)
+	case GNU_PROPERTY_AARCH64_FEATURE_1_AND:
+		return p.Type.String() + ": " + p.flags(aarch64Feature1Strings)
+	case GNU_PROPERTY_NO_COPY_ON_PROTECTED:
+		return p.Type.String()
+	case GNU_PROPERTY_STACK_SIZE:
+		if len(p.Data) == 8 {
+			return fmt.Sprintf("%v: 0x%x", p.Type, p.order.Uint64(p.Data))
+		}
+		if len(p.Data) == 4 {
+			return fmt.Sprintf("%v: 0x%x", p.Type, p.order.Uint32(p.Data))
+		}
+	}
+	if len(p.Data) == 4 {
+		return fmt.Sprintf("%v: 0x%x", p.Type, p.order.Uint32(p.Data))
+	}
+	return fmt.Sprintf("%v: %x", p.Type, p.Data)
+}
+
+func (p GNUProperty) flags(names []intName) string {
+	if len(p.Data) != 4 {
+		return fmt.Sprintf("%x", p.Data)
+	}
+	x := p.order.Uint32(p.Data)
+	if x == 0 {
+		return "<none>"
+	}
+	return flagName(x, names, false)
+}
+
+// ReadGNUProperties decodes the program properties array. Every property
+// is padded to 8 bytes in ELFCLASS64 and to 4 bytes in ELFCLASS32.
+func ReadGNUProperties(n *Note, o binary.ByteOrder, c elf.Class) ([]GNUProperty, error) {
+	if n.Name != "GNU" || n.Type != NT_GNU_PROPERTY_TYPE_0 {
+		return nil, fmt.Errorf("invalid note type: %v/%v", n.Name, n.TypeString())
+	}
+
+	var align int64
+	switch c {
+	case elf.ELFCLASS64:
+		align = 8
+	case elf.ELFCLASS32:
+		align = 4
+	default:
+		return nil, errors.New("unknown elf class")
+	}
+
+	props := []GNUProperty{}
+	r := n.Open()
+	for {
+		var typ, size uint32
+		if err := binary.Read(r, o, &typ); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("read property type failed: %v", err)
+		}
+		if err := binary.Read(r, o, &size); err != nil {
+			return nil, fmt.Errorf("read property size failed: %v", err)
+		}
+
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		pad := (align - int64(size)%align) % align
+		if left := int64(len(n.Data)) - pos; int64(size) > left {
+			return nil, fmt.Errorf("property size %d exceeds the %d bytes left in the note", size, left)
+		} else if int64(size)+pad > left {
+			return nil, fmt.Errorf("property padding is truncated")
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("read property data failed: %v", err)
+		}
+		if _, err := r.Seek(pad, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("skip property padding failed: %v", err)
+		}
+
+		props = append(props, GNUProperty{Type: GNUPropertyType(typ), Data: data, order: o})
+	}
+
+	return props, nil
+}
+
+// DescribeNote returns a human readable representation of the well known
+// note payloads or an empty string if the note type is not decoded.
+func DescribeNote(n *Note, o binary.ByteOrder, c elf.Class) (string, error) {
+	switch n.Name {
+	case "GNU":
+		switch n.Type {
+		case NT_GNU_BUILD_ID:
+			return ReadGNUBuildID(n)
+		case NT_GNU_ABI_TAG:
+			tag, err := ReadGNUABITag(n, o)
+			if err != nil {
+				return "", err
+			}
+			return tag.String(), nil
+		case NT_GNU_GOLD_VERSION:
+			return strings.TrimRight(string(n.Data), "\x00"), nil
+		case NT_GNU_PROPERTY_TYPE_0:
+			props, err := ReadGNUProperties(n, o, c)
+			if err != nil {
+				return "", err
+			}
+			s := make([]string, 0, len(props))
+			for _, p := range props {
+				s = append(s, p.String())
+			}
+			return strings.Join(s, ", "), nil
+		}
+	case "Go":
+		switch n.Type {
+		case NT_GO_BUILD:
+			return string(n.Data), nil
+		case NT_GO_ABIHASH:
+			return hex.EncodeToString(n.Data), nil
+		}
+	case "FreeBSD":
+		switch n.Type {
+		case NT_FREEBSD_ABI_TAG:
+			if len(n.Data) == 4 {
+				return fmt.Sprintf("%d", o.Uint32(n.Data)), nil
+			}
+		case NT_FREEBSD_ARCH_TAG:
+			return strings.TrimRight(string(n.Data), "\x00"), nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,180 @@
+package elf
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/debug/dwarf"
+)
+
+const (
+	gRunning = 2
+	gSyscall = 3
+	gWaiting = 4
+)
+
+// Goroutine is a goroutine of runtime.allgs with its stack unwound.
+type Goroutine struct {
+	Addr   uint64
+	ID     uint64
+	Status uint64
+	// State is the name of Status, WaitReason is set for waiting ones.
+	State      string
+	WaitReason string
+	// WaitSince is the nanotime the goroutine started to wait at, if
+	// known (it is recorded by the GC).
+	WaitSince int64
+	// Thread is the id of the thread running the goroutine, if any.
+	Thread uint64
+	// GoPC is the pc of the go statement creating the goroutine.
+	GoPC uint64
+	// Panic is the innermost panic running on the goroutine.
+	Panic uint64
+	// Stack is the goroutine stack.
+	Stack AddrRange
+	// Waiting is the list of sudogs of the channel operations the
+	// goroutine is blocked on.
+	Waiting uint64
+
+	Frames []Frame
+	// Err tells why Frames are incomplete.
+	Err error
+}
+
+// Thread is the state of a thread of the process, e.g. of NT_PRSTATUS.
+type Thread struct {
+	Tid    uint64
+	PC, SP uint64
+}
+
+// ReadGoroutines reads runtime.allgs but the dead goroutines and unwinds
+// their stacks. The running goroutines are unwound from the registers of
+// their threads if the thread gets to the goroutine stack, others from the
+// context saved by the scheduler.
+func ReadGoroutines(r *MemReader, d *dwarf.Data, u *Unwinder, threads []Thread) ([]*Goroutine, error) {
+	allgs, err := GlobalValue(r, d, "runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	reasons := waitReasons(r, d)
+
+	var gs []*Goroutine
+	n, _ := allgs.Len()
+	for i := uint64(0); i < n && i < maxAll; i++ {
+		gp, err := allgs.Index(i)
+		if err != nil {
+			return gs, err
+		}
+		if gp, err = gp.Elem(); err != nil {
+			continue
+		}
+		status := uintPath(gp, "atomicstatus") &^ gScan
+		if status == gDead {
+			continue
+		}
+
+		g := &Goroutine{
+			Addr:      gp.Addr,
+			ID:        uintPath(gp, "goid"),
+			Status:    status,
+			WaitSince: intPath(gp, "waitsince"),
+			GoPC:      uintPath(gp, "gopc"),
+			Panic:     uintPath(gp, "_panic"),
+			Stack:     AddrRange{uintPath(gp, "stack", "lo"), uintPath(gp, "stack", "hi")},
+			Waiting:   uintPath(gp, "waiting"),
+		}
+		g.State = fmt.Sprintf("status %d", status)
+		if status < uint64(len(GoroutineStatus)) {
+			g.State = GoroutineStatus[status]
+		}
+		if reason := uintPath(gp, "waitreason"); status == gWaiting && reason < uint64(len(reasons)) {
+			g.WaitReason = reasons[reason]
+		}
+
+		pc, sp := uintPath(gp, "sched", "pc"), uintPath(gp, "sched", "sp")
+		if status == gSyscall && uintPath(gp, "syscallsp") != 0 {
+			pc, sp = uintPath(gp, "syscallpc"), uintPath(gp, "syscallsp")
+		}
+		if status == gRunning || status == gSyscall {
+			g.Thread = uintPath(gp, "m", "procid")
+			for _, t := range threads {
+				if t.Tid != g.Thread || g.Thread == 0 {
+					continue
+				}
+				// the thread may be on the signal stack, the goroutine
+				// frames follow the signal handler
+				frames, err := u.Unwind(t.PC, t.SP)
+				for i, f := range frames {
+					if f.SP >= g.Stack.Start && f.SP < g.Stack.End {
+						g.Frames, g.Err = frames[i:], err
+						break
+					}
+				}
+			}
+		}
+
+		switch {
+		case g.Frames != nil:
+		case pc != 0 && sp != 0:
+			g.Frames, g.Err = u.Unwind(pc, sp)
+		default:
+			g.Err = fmt.Errorf("no saved context")
+		}
+		gs = append(gs, g)
+	}
+
+	return gs, nil
+}
+
+// waitReasons returns runtime.waitReasonStrings.
+func waitReasons(r *MemReader, d *dwarf.Data) []string {
+	v, err := GlobalValue(r, d, "runtime.waitReasonStrings")
+	if err != nil {
+		return nil
+	}
+	n, _ := v.Len()
+	var reasons []string
+	for i := uint64(0); i < n; i++ {
+		s, err := v.Index(i)
+		if err != nil {
+			break
+		}
+		str, _ := s.String(256)
+		reasons = append(reasons, str)
+	}
+	return reasons
+}
+
+// Nanotime estimates the runtime nanotime at the moment of the core by
+// the latest times recorded by the runtime: the last network poll, the
+// last GC and the waits of the goroutines. It is 0 if none is known.
+func Nanotime(r *MemReader, d *dwarf.Data, gs []*Goroutine) int64 {
+	var now int64
+	latest := func(t int64) {
+		if t > now {
+			now = t
+		}
+	}
+	if sched, err := GlobalValue(r, d, "runtime.sched"); err == nil {
+		latest(intPath(sched, "lastpoll", "value"))
+	}
+	if memstats, err := GlobalValue(r, d, "runtime.memstats"); err == nil {
+		latest(int64(uintPath(memstats, "last_gc_nanotime")))
+	}
+	if work, err := GlobalValue(r, d, "runtime.work"); err == nil {
+		latest(intPath(work, "tstart"))
+	}
+	for _, g := range gs {
+		latest(g.WaitSince)
+	}
+	return now
+}
+
+// Wait returns how long the goroutine waits at the nanotime now, 0 if it
+// is unknown.
+func (g *Goroutine) Wait(now int64) time.Duration {
+	if g.WaitSince == 0 || now < g.WaitSince {
+		return 0
+	}
+	return time.Duration(now - g.WaitSince)
+}
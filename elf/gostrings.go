@@ -0,0 +1,235 @@
+package elf
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/arch/x86/x86asm"
+	"golang.org/x/debug/elf"
+)
+
+// GoString is a string literal recovered from a Go binary.
+type GoString struct {
+	Addr  uint64
+	Value string
+
+	// Source tells where the length of the string comes from: name of the
+	// section holding the string header, "symtab" for go.string."..."
+	// symbols and ".text" for the lengths the code loads with the address.
+	Source string
+}
+
+// GoStringsOptions limits the strings reported by ReadGoStrings.
+type GoStringsOptions struct {
+	MinLen int
+	MaxLen int
+}
+
+// ReadGoStrings recovers Go string literals. Go strings are not NUL
+// terminated, so their bounds are taken from string headers {ptr, len}
+// found in .data and .noptrdata, from the sizes of go.string."..." symbols
+// of old linkers and, for the go:string.* blob on x86, from the code
+// loading the address of a literal followed by its length. The rest of
+// the blob has no known bounds and is left out.
+func ReadGoStrings(f *elf.File, syms []elf.Symbol, opts GoStringsOptions) ([]GoString, error) {
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = 1 << 16
+	}
+
+	rodata := f.Section(".rodata")
+	if rodata == nil {
+		return nil, errors.New("no .rodata section")
+	}
+	ro, err := SectionData(f, rodata)
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[uint64]GoString{}
+	add := func(addr, size uint64, source string) {
+		if size == 0 || size > uint64(opts.MaxLen) || addr < rodata.Addr || addr+size > rodata.Addr+uint64(len(ro)) {
+			return
+		}
+		s := string(ro[addr-rodata.Addr : addr-rodata.Addr+size])
+		if !isText(s) {
+			return
+		}
+		if prev, ok := found[addr]; ok && len(prev.Value) >= len(s) {
+			return
+		}
+		found[addr] = GoString{Addr: addr, Value: s, Source: source}
+	}
+
+	ptrSize := 8
+	if f.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+	word := func(b []byte) uint64 {
+		if ptrSize == 8 {
+			return f.ByteOrder.Uint64(b)
+		}
+		return uint64(f.ByteOrder.Uint32(b))
+	}
+
+	for _, name := range []string{".data", ".noptrdata", ".data.rel.ro"} {
+		s := f.Section(name)
+		if s == nil || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := SectionData(f, s)
+		if err != nil {
+			return nil, err
+		}
+		for off := 0; off+2*ptrSize <= len(data); off += ptrSize {
+			add(word(data[off:]), word(data[off+ptrSize:]), name)
+		}
+	}
+
+	var blobStart, blobEnd uint64
+	for _, s := range syms {
+		switch {
+		case strings.HasPrefix(s.Name, `go.string."`) || strings.HasPrefix(s.Name, `go:string."`):
+			add(s.Value, s.Size, "symtab")
+		case s.Name == "go.string.*" || s.Name == "go:string.*":
+			blobStart = s.Value
+		}
+	}
+	if blobStart != 0 {
+		blobEnd = rodata.Addr + uint64(len(ro))
+		for _, s := range syms {
+			if s.Value > blobStart && s.Value < blobEnd {
+				blobEnd = s.Value
+			}
+		}
+		if err := codeStrings(f, blobStart, blobEnd, func(addr, size uint64) {
+			add(addr, size, ".text")
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]GoString, 0, len(found))
+	for _, s := range found {
+		if utf8.RuneCountInString(s.Value) >= opts.MinLen {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Addr < result[j].Addr })
+
+	return result, nil
+}
+
+// maxStringLoad is how many instructions after the address of a string
+// its length is looked for.
+const maxStringLoad = 3
+
+// nextArgReg is the register of the register ABI following the one
+// passing the pointer of a string, the one passing its length.
+var nextArgReg = map[x86asm.Reg]x86asm.Reg{
+	x86asm.RAX: x86asm.RBX,
+	x86asm.RBX: x86asm.RCX,
+	x86asm.RCX: x86asm.RDI,
+	x86asm.RDI: x86asm.RSI,
+	x86asm.RSI: x86asm.R8,
+	x86asm.R8:  x86asm.R9,
+	x86asm.R9:  x86asm.R10,
+	x86asm.R10: x86asm.R11,
+}
+
+// codeStrings calls fn for the string literals of [start, end) the code
+// refers to: LEA of the address to a register followed by a MOV of the
+// length constant to the next register of the ABI or, when the pointer
+// is stored to memory, to the word after it.
+func codeStrings(f *elf.File, start, end uint64, fn func(addr, size uint64)) error {
+	mode := 0
+	switch f.Machine {
+	case elf.EM_X86_64:
+		mode = 64
+	case elf.EM_386:
+		mode = 32
+	}
+	text := f.Section(".text")
+	if mode == 0 || text == nil {
+		return nil
+	}
+	code, err := SectionData(f, text)
+	if err != nil {
+		return err
+	}
+
+	var addr uint64
+	var reg x86asm.Reg
+	var slot *x86asm.Mem
+	after := 0
+	for pc := text.Addr; len(code) > 0; {
+		inst, err := x86asm.Decode(code, mode)
+		if err != nil || inst.Len == 0 {
+			// skip the undecodable byte
+			code, pc = code[1:], pc+1
+			continue
+		}
+		code, pc = code[inst.Len:], pc+uint64(inst.Len)
+
+		if inst.Op == x86asm.LEA {
+			m, _ := inst.Args[1].(x86asm.Mem)
+			a := pc + uint64(m.Disp)
+			if mode == 32 {
+				a = uint64(uint32(m.Disp))
+			}
+			if (m.Base == x86asm.RIP || mode == 32 && m.Base == 0) && m.Index == 0 && a >= start && a < end {
+				dst, _ := inst.Args[0].(x86asm.Reg)
+				addr, reg, slot, after = a, fullReg(dst), nil, 0
+				continue
+			}
+		}
+		if addr == 0 || inst.Op != x86asm.MOV {
+			if after++; after >= maxStringLoad {
+				addr = 0
+			}
+			continue
+		}
+
+		switch dst := inst.Args[0].(type) {
+		case x86asm.Reg:
+			if imm, ok := inst.Args[1].(x86asm.Imm); ok && mode == 64 && fullReg(dst) == nextArgReg[reg] {
+				if imm > 0 && addr+uint64(imm) <= end {
+					fn(addr, uint64(imm))
+				}
+				addr = 0
+				continue
+			}
+		case x86asm.Mem:
+			if src, ok := inst.Args[1].(x86asm.Reg); ok && fullReg(src) == reg && slot == nil {
+				slot = &dst
+				continue
+			}
+			if imm, ok := inst.Args[1].(x86asm.Imm); ok && slot != nil &&
+				dst.Base == slot.Base && dst.Index == slot.Index && dst.Disp == slot.Disp+int64(mode/8) {
+				if imm > 0 && addr+uint64(imm) <= end {
+					fn(addr, uint64(imm))
+				}
+				addr = 0
+				continue
+			}
+		}
+		if after++; after >= maxStringLoad {
+			addr = 0
+		}
+	}
+	return nil
+}
+
+func isText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,558 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Type flags of runtime._type (internal/abi.TFlag).
+const (
+	TFlagUncommon      = 1 << 0
+	TFlagExtraStar     = 1 << 1
+	TFlagNamed         = 1 << 2
+	TFlagRegularMemory = 1 << 3
+)
+
+const kindMask = 0x1f
+
+// GoType is a decoded runtime._type with its kind specific part.
+// References to other types are kept as descriptor addresses.
+type GoType struct {
+	Addr       uint64
+	Size       uint64
+	PtrData    uint64
+	Hash       uint32
+	TFlag      uint8
+	Align      uint8
+	FieldAlign uint8
+	Kind       reflect.Kind
+
+	Name    string
+	PkgPath string
+
+	Elem     uint64 // array, chan, map, pointer, slice
+	Key      uint64 // map
+	Len      uint64 // array
+	ChanDir  reflect.ChanDir
+	In, Out  []uint64
+	Variadic bool
+	Fields   []GoStructField
+	IMethods []GoIMethod
+
+	Methods []GoMethod
+
+	// descriptor size, used to walk contiguous type descriptors
+	descSize uint64
+}
+
+func (t *GoType) Named() bool { return t.TFlag&TFlagNamed != 0 }
+
+type GoStructField struct {
+	Name     string
+	Tag      string
+	Type     uint64
+	Offset   uint64
+	Embedded bool
+}
+
+type GoIMethod struct {
+	Name string
+	Type uint64
+}
+
+// GoMethod is a method of the uncommon type. IFn and TFn are zero
+// for methods removed by the linker dead code elimination.
+type GoMethod struct {
+	Name string
+	Type uint64
+	IFn  uint64
+	TFn  uint64
+}
+
+// TypeReader decodes Go runtime type descriptors of a module.
+type TypeReader struct {
+	r  *MemReader
+	md *ModuleData
+
+	typeSize uint64
+	cache    map[uint64]*GoType
+}
+
+func NewTypeReader(r *MemReader, md *ModuleData) *TypeReader {
+	return &TypeReader{
+		r:        r,
+		md:       md,
+		typeSize: 4*uint64(r.PtrSize) + 16,
+		cache:    map[uint64]*GoType{},
+	}
+}
+
+// TypeLinks returns the addresses of type descriptors of the module either
+// from the typelinks table or by walking contiguous descriptors.
+func (tr *TypeReader) TypeLinks() ([]uint64, error) {
+	md := tr.md
+
+	if !md.HasTypeLinks() {
+		var links []uint64
+		ps := uint64(tr.r.PtrSize)
+		end := md.Types + md.TypeDescLen
+		for td := md.Types + ps; td < end; {
+			td = tr.r.Align(td)
+			t, err := tr.Type(td)
+			if err != nil {
+				return links, err
+			}
+			if t.descSize == 0 {
+				return links, fmt.Errorf("invalid type descriptor at 0x%x", td)
+			}
+			links = append(links, td)
+			td += t.descSize
+		}
+		return links, nil
+	}
+
+	if md.TypeLinks.Len > 1<<24 {
+		return nil, fmt.Errorf("invalid typelinks length %d", md.TypeLinks.Len)
+	}
+	b, err := tr.r.Bytes(md.TypeLinks.Data, int(4*md.TypeLinks.Len))
+	if err != nil {
+		return nil, err
+	}
+	links := make([]uint64, 0, md.TypeLinks.Len)
+	for i := uint64(0); i < md.TypeLinks.Len; i++ {
+		links = append(links, md.Types+uint64(int64(int32(tr.r.Order.Uint32(b[4*i:])))))
+	}
+	return links, nil
+}
+
+// TypeOff resolves typeOff relative to the module types.
+func (tr *TypeReader) TypeOff(off int32) uint64 {
+	if off == 0 || off == -1 {
+		return 0
+	}
+	return uint64(int64(tr.md.Types) + int64(off))
+}
+
+func (tr *TypeReader) textOff(off int32) uint64 {
+	if off == -1 {
+		return 0
+	}
+	return uint64(int64(tr.md.Text) + int64(off))
+}
+
+// TypeName returns the type string of the descriptor or its address.
+func (tr *TypeReader) TypeName(addr uint64) string {
+	if addr == 0 {
+		return "<nil>"
+	}
+	t, err := tr.Type(addr)
+	if err != nil {
+		return fmt.Sprintf("<type 0x%x>", addr)
+	}
+	return t.Name
+}
+
+// DWARFNames returns the names the type may have in Go DWARF, which
+// qualifies named types by the package path instead of the package name
+// of the runtime type strings. Named types missing in DWARF are followed
+// by the name of their underlying composite type.
+func (tr *TypeReader) DWARFNames(addr uint64) []string {
+	t, err := tr.Type(addr)
+	if err != nil {
+		return nil
+	}
+	names := []string{tr.dwarfName(t, false)}
+	if t.Named() && t.Elem != 0 {
+		names = append(names, tr.dwarfName(t, true))
+	}
+	return names
+}
+
+func (tr *TypeReader) dwarfName(t *GoType, underlying bool) string {
+	if t.Named() && !underlying {
+		if i := strings.IndexByte(t.Name, '.'); i >= 0 && t.PkgPath != "" {
+			return t.PkgPath + t.Name[i:]
+		}
+		return t.Name
+	}
+
+	elem := func(addr uint64) string {
+		if e, err := tr.Type(addr); err == nil {
+			return tr.dwarfName(e, false)
+		}
+		return tr.TypeName(addr)
+	}
+	switch t.Kind {
+	case reflect.Ptr:
+		return "*" + elem(t.Elem)
+	case reflect.Slice:
+		return "[]" + elem(t.Elem)
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len, elem(t.Elem))
+	case reflect.Map:
+		return "map[" + elem(t.Key) + "]" + elem(t.Elem)
+	case reflect.Chan:
+		switch t.ChanDir {
+		case reflect.RecvDir:
+			return "<-chan " + elem(t.Elem)
+		case reflect.SendDir:
+			return "chan<- " + elem(t.Elem)
+		}
+		return "chan " + elem(t.Elem)
+	}
+	return t.Name
+}
+
+// Type decodes the type descriptor at addr.
+func (tr *TypeReader) Type(addr uint64) (*GoType, error) {
+	if t, ok := tr.cache[addr]; ok {
+		return t, nil
+	}
+	if addr == 0 {
+		return nil, errors.New("nil type")
+	}
+
+	r := tr.r
+	ps := uint64(r.PtrSize)
+
+	hdr, err := r.Bytes(addr, int(tr.typeSize))
+	if err != nil {
+		return nil, fmt.Errorf("read type at 0x%x failed: %v", addr, err)
+	}
+
+	word := func(i uint64) uint64 { return r.word(hdr[i:]) }
+
+	t := &GoType{Addr: addr}
+	t.Size = word(0)
+	t.PtrData = word(ps)
+	t.Hash = r.Order.Uint32(hdr[2*ps:])
+	t.TFlag = hdr[2*ps+4]
+	t.Align = hdr[2*ps+5]
+	t.FieldAlign = hdr[2*ps+6]
+	t.Kind = reflect.Kind(hdr[2*ps+7] & kindMask)
+	str := int32(r.Order.Uint32(hdr[4*ps+8:]))
+
+	if t.Kind == reflect.Invalid || t.Kind > reflect.UnsafePointer {
+		return nil, fmt.Errorf("invalid type kind %d at 0x%x", hdr[2*ps+7], addr)
+	}
+
+	if t.Name, _, err = tr.nameOff(str); err != nil {
+		return nil, fmt.Errorf("read type name at 0x%x failed: %v", addr, err)
+	}
+	if t.TFlag&TFlagExtraStar != 0 && len(t.Name) > 0 {
+		t.Name = t.Name[1:]
+	}
+
+	tr.cache[addr] = t
+
+	base := tr.typeSize
+	var add uint64
+
+	x := addr + tr.typeSize
+	switch t.Kind {
+	case reflect.Array:
+		if t.Elem, err = r.Ptr(x); err == nil {
+			t.Len, err = r.Ptr(x + 2*ps)
+		}
+		base += 3 * ps
+	case reflect.Chan:
+		var dir uint64
+		if t.Elem, err = r.Ptr(x); err == nil {
+			dir, err = r.Ptr(x + ps)
+			t.ChanDir = reflect.ChanDir(dir)
+		}
+		base += 2 * ps
+	case reflect.Func:
+		var in, out uint16
+		if in, err = r.Uint16(x); err == nil {
+			out, err = r.Uint16(x + 2)
+		}
+		t.Variadic = out&(1<<15) != 0
+		out &= 1<<15 - 1
+		base = r.Align(base + 4)
+		add = uint64(in+out) * ps
+		if err == nil {
+			params := addr + base
+			if t.TFlag&TFlagUncommon != 0 {
+				params += 16
+			}
+			for i := uint16(0); i < in+out && err == nil; i++ {
+				var p uint64
+				p, err = r.Ptr(params + uint64(i)*ps)
+				if i < in {
+					t.In = append(t.In, p)
+				} else {
+					t.Out = append(t.Out, p)
+				}
+			}
+		}
+	case reflect.Interface:
+		var pkg uint64
+		var methods SliceHeader
+		if pkg, err = r.Ptr(x); err == nil && pkg != 0 {
+			t.PkgPath, _, _, err = tr.name(pkg)
+		}
+		if err == nil {
+			methods, err = r.Slice(x + ps)
+		}
+		for i := uint64(0); i < methods.Len && err == nil && i < 1<<16; i++ {
+			var name, typ int32
+			if name, err = r.Int32(methods.Data + 8*i); err != nil {
+				break
+			}
+			if typ, err = r.Int32(methods.Data + 8*i + 4); err != nil {
+				break
+			}
+			m := GoIMethod{Type: tr.TypeOff(typ)}
+			m.Name, _, err = tr.nameOff(name)
+			t.IMethods = append(t.IMethods, m)
+		}
+		base += 4 * ps
+		add = methods.Len * 8
+	case reflect.Map:
+		if t.Key, err = r.Ptr(x); err == nil {
+			t.Elem, err = r.Ptr(x + ps)
+		}
+		base += tr.mapTypeSize()
+	case reflect.Ptr, reflect.Slice:
+		t.Elem, err = r.Ptr(x)
+		base += ps
+	case reflect.Struct:
+		var pkg uint64
+		var fields SliceHeader
+		if pkg, err = r.Ptr(x); err == nil && pkg != 0 {
+			t.PkgPath, _, _, err = tr.name(pkg)
+		}
+		if err == nil {
+			fields, err = r.Slice(x + ps)
+		}
+		for i := uint64(0); i < fields.Len && err == nil && i < 1<<16; i++ {
+			var f GoStructField
+			if f, err = tr.structField(fields.Data + 3*ps*i); err == nil {
+				t.Fields = append(t.Fields, f)
+			}
+		}
+		base += 4 * ps
+		add = fields.Len * 3 * ps
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %v type at 0x%x failed: %v", t.Kind, addr, err)
+	}
+
+	t.descSize = base + add
+	if t.TFlag&TFlagUncommon != 0 {
+		mcount, err := tr.uncommon(t, addr+base)
+		if err != nil {
+			return nil, fmt.Errorf("read uncommon type at 0x%x failed: %v", addr, err)
+		}
+		t.descSize += 16 + uint64(mcount)*16
+	}
+
+	return t, nil
+}
+
+func (tr *TypeReader) mapTypeSize() uint64 {
+	ps := uint64(tr.r.PtrSize)
+	v := tr.md.Version
+	switch {
+	case v.AtLeast(27):
+		// key, elem, group, hasher, groupsize, keysoff, keystride,
+		// elemsoff, elemstride, elemoff, flags
+		return 10*ps + tr.r.Align(4)
+	case v.AtLeast(24):
+		// key, elem, group, hasher, groupsize, slotsize, elemoff, flags
+		return 7*ps + tr.r.Align(4)
+	case v.AtLeast(14):
+		// key, elem, bucket, hasher, keysize, valuesize, bucketsize, flags
+		return 4*ps + 8
+	}
+	return 3*ps + 8
+}
+
+func (tr *TypeReader) uncommon(t *GoType, addr uint64) (uint16, error) {
+	r := tr.r
+
+	b, err := r.Bytes(addr, 16)
+	if err != nil {
+		return 0, err
+	}
+	pkg := int32(r.Order.Uint32(b))
+	mcount := r.Order.Uint16(b[4:])
+	moff := r.Order.Uint32(b[8:])
+
+	if pkg != 0 && t.PkgPath == "" {
+		if t.PkgPath, _, err = tr.nameOff(pkg); err != nil {
+			return 0, err
+		}
+	}
+
+	if mcount == 0 {
+		return 0, nil
+	}
+	mb, err := r.Bytes(addr+uint64(moff), 16*int(mcount))
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < int(mcount); i++ {
+		m := mb[16*i:]
+		gm := GoMethod{
+			Type: tr.TypeOff(int32(r.Order.Uint32(m[4:]))),
+			IFn:  tr.textOff(int32(r.Order.Uint32(m[8:]))),
+			TFn:  tr.textOff(int32(r.Order.Uint32(m[12:]))),
+		}
+		if gm.Name, _, err = tr.nameOff(int32(r.Order.Uint32(m))); err != nil {
+			return 0, err
+		}
+		t.Methods = append(t.Methods, gm)
+	}
+
+	return mcount, nil
+}
+
+func (tr *TypeReader) structField(addr uint64) (GoStructField, error) {
+	r := tr.r
+	ps := uint64(r.PtrSize)
+
+	f := GoStructField{}
+	name, err := r.Ptr(addr)
+	if err != nil {
+		return f, err
+	}
+	if f.Type, err = r.Ptr(addr + ps); err != nil {
+		return f, err
+	}
+	off, err := r.Ptr(addr + 2*ps)
+	if err != nil {
+		return f, err
+	}
+
+	var flags byte
+	if f.Name, f.Tag, flags, err = tr.name(name); err != nil {
+		return f, err
+	}
+
+	if tr.md.Version.AtLeast(19) {
+		f.Offset = off
+		f.Embedded = flags&(1<<3) != 0
+	} else {
+		f.Offset = off >> 1
+		f.Embedded = off&1 != 0
+	}
+
+	return f, nil
+}
+
+func (tr *TypeReader) nameOff(off int32) (string, byte, error) {
+	if off == 0 {
+		return "", 0, nil
+	}
+	n, _, flags, err := tr.name(uint64(int64(tr.md.Types) + int64(off)))
+	return n, flags, err
+}
+
+// name decodes runtime name: flags byte followed by the length (varint
+// since Go 1.17, big-endian uint16 before), the name and the optional tag.
+func (tr *TypeReader) name(addr uint64) (name, tag string, flags byte, err error) {
+	r := tr.r
+
+	b, err := r.Bytes(addr, 1)
+	if err != nil {
+		return "", "", 0, err
+	}
+	flags = b[0]
+
+	readStr := func(at uint64) (string, uint64, error) {
+		var n, k uint64
+		if tr.md.Version.AtLeast(17) {
+			buf, err := r.Bytes(at, binary.MaxVarintLen32)
+			if err != nil {
+				// the name may end right at the end of the mapping
+				if buf, err = r.Bytes(at, 2); err != nil {
+					return "", 0, err
+				}
+			}
+			x, m := binary.Uvarint(buf)
+			if m <= 0 {
+				return "", 0, fmt.Errorf("invalid name length at 0x%x", at)
+			}
+			n, k = x, uint64(m)
+		} else {
+			b, err := r.Bytes(at, 2)
+			if err != nil {
+				return "", 0, err
+			}
+			n, k = uint64(b[0])<<8|uint64(b[1]), 2
+		}
+		s, err := r.StringAt(at+k, n, 0)
+		return s, at + k + n, err
+	}
+
+	name, next, err := readStr(addr + 1)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if flags&(1<<1) != 0 {
+		if tag, _, err = readStr(next); err != nil {
+			return "", "", 0, err
+		}
+	}
+
+	return name, tag, flags, nil
+}
+
+// AllTypes decodes typelinked types and all types reachable from them:
+// element, key, field, parameter and method types. Named types are
+// usually only reachable that way.
+func (tr *TypeReader) AllTypes() ([]*GoType, error) {
+	links, err := tr.TypeLinks()
+
+	seen := map[uint64]bool{}
+	queue := append([]uint64{}, links...)
+	types := []*GoType{}
+	for len(queue) > 0 {
+		addr := queue[0]
+		queue = queue[1:]
+		if addr == 0 || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+
+		t, terr := tr.Type(addr)
+		if terr != nil {
+			if err == nil {
+				err = terr
+			}
+			continue
+		}
+		types = append(types, t)
+
+		queue = append(queue, t.Elem, t.Key)
+		queue = append(queue, t.In...)
+		queue = append(queue, t.Out...)
+		for _, f := range t.Fields {
+			queue = append(queue, f.Type)
+		}
+		for _, m := range t.IMethods {
+			queue = append(queue, m.Type)
+		}
+		for _, m := range t.Methods {
+			queue = append(queue, m.Type)
+		}
+	}
+
+	return types, err
+}
+
+// SortTypes orders type descriptors by the type string.
+func SortTypes(types []*GoType) {
+	sort.Slice(types, func(i, j int) bool {
+		if types[i].Name != types[j].Name {
+			return types[i].Name < types[j].Name
+		}
+		return types[i].Addr < types[j].Addr
+	})
+}
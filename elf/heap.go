@@ -0,0 +1,227 @@
+package elf
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug/dwarf"
+)
+
+const mSpanInUse = 1
+
+// minSizeForMallocHeader is the size objects in small spans with pointers
+// start with the type header above since Go 1.22: the size one pointer
+// bitmap word covers.
+func minSizeForMallocHeader(ptrSize int) uint64 {
+	return uint64(ptrSize * ptrSize * 8)
+}
+
+// HeapObject is an allocated object of the Go heap.
+type HeapObject struct {
+	Addr uint64
+	Size uint64
+	// Class is the size class, 0 for large objects.
+	Class  int
+	NoScan bool
+	// Type is the runtime type descriptor if known (Go 1.22+ malloc
+	// headers and large objects), 0 otherwise.
+	Type uint64
+}
+
+// HeapSpan is an in use span of the heap.
+type HeapSpan struct {
+	Start    uint64
+	Pages    uint64
+	ElemSize uint64
+	Class    int
+	NoScan   bool
+	Objects  int
+}
+
+// WalkHeap calls fn for every in use span of runtime.mheap_ and span for
+// every allocated object in it. Objects are allocated if they are below
+// the free index or marked in the allocation bits.
+func WalkHeap(r *MemReader, d *dwarf.Data, span func(s HeapSpan) error, fn func(o HeapObject) error) error {
+	heap, err := GlobalValue(r, d, "runtime.mheap_")
+	if err != nil {
+		return err
+	}
+	all, err := heap.Field("allspans")
+	if err != nil {
+		return err
+	}
+	n, err := all.Len()
+	if err != nil {
+		return err
+	}
+
+	for i := uint64(0); i < n; i++ {
+		sp, err := all.Index(i)
+		if err != nil {
+			return err
+		}
+		if sp, err = sp.Elem(); err != nil {
+			continue
+		}
+		if err := walkSpan(r, sp, span, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkSpan(r *MemReader, sp Value, span func(s HeapSpan) error, fn func(o HeapObject) error) error {
+	u := func(name string) uint64 {
+		f, err := sp.Field(name)
+		if err != nil {
+			return 0
+		}
+		v, _ := f.Uint()
+		return v
+	}
+
+	if u("state") != mSpanInUse {
+		return nil
+	}
+
+	s := HeapSpan{
+		Start:    u("startAddr"),
+		Pages:    u("npages"),
+		ElemSize: u("elemsize"),
+	}
+	spanclass := u("spanclass")
+	s.Class, s.NoScan = int(spanclass>>1), spanclass&1 != 0
+	nelems, freeindex := u("nelems"), u("freeindex")
+	if s.ElemSize == 0 || nelems > 1<<16 {
+		return nil
+	}
+
+	var bits []byte
+	if p := u("allocBits"); p != 0 {
+		bits, _ = r.Bytes(p, int(nelems+7)/8)
+	}
+
+	// large objects keep the type in the span, Go 1.22+
+	var largeType uint64
+	if sp.HasField("largeType") && s.Class == 0 && !s.NoScan {
+		largeType = u("largeType")
+	}
+	header := sp.HasField("largeType") && s.Class != 0 && !s.NoScan && s.ElemSize > minSizeForMallocHeader(r.PtrSize)
+
+	for i := uint64(0); i < nelems; i++ {
+		if i >= freeindex && (i/8 >= uint64(len(bits)) || bits[i/8]&(1<<(i%8)) == 0) {
+			continue
+		}
+		s.Objects++
+
+		o := HeapObject{
+			Addr:   s.Start + i*s.ElemSize,
+			Size:   s.ElemSize,
+			Class:  s.Class,
+			NoScan: s.NoScan,
+			Type:   largeType,
+		}
+		if header {
+			o.Type, _ = r.Ptr(o.Addr)
+		}
+		if fn != nil {
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+	}
+
+	if span != nil {
+		return span(s)
+	}
+	return nil
+}
+
+// HeapTypeStat is the census entry of a type or a size class.
+type HeapTypeStat struct {
+	Name  string
+	Class int
+	// Size is the object size of a size class, 0 for types and large
+	// objects.
+	Size  uint64
+	Count uint64
+	Bytes uint64
+	Spans uint64
+}
+
+// HeapCensus counts heap objects by type and by size class. Objects of
+// unknown type are named after their size class.
+type HeapCensus struct {
+	Objects uint64
+	Bytes   uint64
+	Types   []*HeapTypeStat
+	Classes []*HeapTypeStat
+}
+
+// ReadHeapCensus walks the heap and aggregates its objects. typeName
+// resolves runtime type descriptors.
+func ReadHeapCensus(r *MemReader, d *dwarf.Data, typeName func(addr uint64) string) (*HeapCensus, error) {
+	types := map[string]*HeapTypeStat{}
+	classes := map[int]*HeapTypeStat{}
+
+	c := &HeapCensus{}
+	class := func(n int, size uint64) *HeapTypeStat {
+		cs := classes[n]
+		if cs == nil {
+			cs = &HeapTypeStat{Name: fmt.Sprintf("class %d", n), Class: n, Size: size}
+			if n == 0 {
+				cs.Name, cs.Size = "large", 0
+			}
+			classes[n] = cs
+		}
+		return cs
+	}
+
+	err := WalkHeap(r, d, func(s HeapSpan) error {
+		class(s.Class, s.ElemSize).Spans++
+		return nil
+	}, func(o HeapObject) error {
+		c.Objects++
+		c.Bytes += o.Size
+
+		cs := class(o.Class, o.Size)
+		cs.Count++
+		cs.Bytes += o.Size
+
+		name := fmt.Sprintf("<unknown %d>", o.Size)
+		if o.NoScan {
+			name = fmt.Sprintf("<noscan %d>", o.Size)
+		}
+		if o.Type != 0 && typeName != nil {
+			name = typeName(o.Type)
+		}
+		ts := types[name]
+		if ts == nil {
+			ts = &HeapTypeStat{Name: name, Class: o.Class}
+			types[name] = ts
+		}
+		ts.Count++
+		ts.Bytes += o.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ts := range types {
+		c.Types = append(c.Types, ts)
+	}
+	sort.Slice(c.Types, func(i, j int) bool {
+		if c.Types[i].Bytes != c.Types[j].Bytes {
+			return c.Types[i].Bytes > c.Types[j].Bytes
+		}
+		return c.Types[i].Name < c.Types[j].Name
+	})
+	for _, cs := range classes {
+		c.Classes = append(c.Classes, cs)
+	}
+	sort.Slice(c.Classes, func(i, j int) bool { return c.Classes[i].Class < c.Classes[j].Class })
+
+	return c, nil
+}
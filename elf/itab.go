@@ -0,0 +1,107 @@
+package elf
+
+import (
+	"fmt"
+)
+
+// GoITab is a decoded runtime.itab: the interface, the concrete type and
+// the method table in the order of interface methods. A Fun of a single
+// zero entry means the type does not implement the interface.
+type GoITab struct {
+	Addr  uint64
+	Inter uint64
+	Type  uint64
+	Hash  uint32
+	Fun   []uint64
+
+	size uint64
+}
+
+// ITab decodes the itab at addr.
+func (tr *TypeReader) ITab(addr uint64) (*GoITab, error) {
+	r := tr.r
+	ps := uint64(r.PtrSize)
+
+	it := &GoITab{Addr: addr}
+
+	var err error
+	if it.Inter, err = r.Ptr(addr); err != nil {
+		return nil, fmt.Errorf("read itab at 0x%x failed: %v", addr, err)
+	}
+	if it.Type, err = r.Ptr(addr + ps); err != nil {
+		return nil, fmt.Errorf("read itab at 0x%x failed: %v", addr, err)
+	}
+	if it.Hash, err = r.Uint32(addr + 2*ps); err != nil {
+		return nil, fmt.Errorf("read itab at 0x%x failed: %v", addr, err)
+	}
+
+	inter, err := tr.Type(it.Inter)
+	if err != nil {
+		return nil, fmt.Errorf("read itab at 0x%x interface failed: %v", addr, err)
+	}
+
+	// hash is followed by _ [4]byte before Go 1.22
+	fun := r.Align(addr + 2*ps + 4)
+	if !tr.md.Version.AtLeast(22) {
+		fun = addr + 2*ps + 8
+	}
+	n := len(inter.IMethods)
+	if n == 0 {
+		n = 1
+	}
+	for i := 0; i < n; i++ {
+		f, err := r.Ptr(fun + uint64(i)*ps)
+		if err != nil {
+			return nil, fmt.Errorf("read itab at 0x%x fun failed: %v", addr, err)
+		}
+		if i == 0 && f == 0 {
+			n = 1
+		}
+		it.Fun = append(it.Fun, f)
+	}
+	if len(inter.IMethods) == 0 || it.Fun[0] == 0 {
+		it.Fun = it.Fun[:1]
+	}
+	it.size = fun - addr + uint64(len(it.Fun))*ps
+
+	return it, nil
+}
+
+// ITabs returns the itabs materialized by the linker: listed in itablinks
+// or laid out contiguously after type descriptors since Go 1.26.
+func (tr *TypeReader) ITabs() ([]*GoITab, error) {
+	md := tr.md
+	r := tr.r
+	ps := uint64(r.PtrSize)
+
+	var itabs []*GoITab
+	if !md.HasTypeLinks() {
+		end := md.Types + md.ITabOffset + md.ITabSize
+		for p := md.Types + md.ITabOffset; p < end; {
+			it, err := tr.ITab(p)
+			if err != nil {
+				return itabs, err
+			}
+			itabs = append(itabs, it)
+			p = r.Align(p + it.size)
+		}
+		return itabs, nil
+	}
+
+	if md.ITabLinks.Len > 1<<24 {
+		return nil, fmt.Errorf("invalid itablinks length %d", md.ITabLinks.Len)
+	}
+	for i := uint64(0); i < md.ITabLinks.Len; i++ {
+		p, err := r.Ptr(md.ITabLinks.Data + i*ps)
+		if err != nil {
+			return itabs, err
+		}
+		it, err := tr.ITab(p)
+		if err != nil {
+			return itabs, err
+		}
+		itabs = append(itabs, it)
+	}
+
+	return itabs, nil
+}
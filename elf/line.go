@@ -0,0 +1,516 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+// The vendored dwarf package evaluates only the line program of the first
+// compile unit and does not know DWARF 5, so .debug_line is decoded here.
+
+// LineRow is a row of the line number matrix.
+type LineRow struct {
+	Addr        uint64
+	File        string
+	Line        int
+	Column      int
+	IsStmt      bool
+	EndSequence bool
+}
+
+// LineTable is the line number program of a single compile unit.
+type LineTable struct {
+	Offset  uint64
+	Version int
+	Files   []string
+	Rows    []LineRow
+}
+
+// Lines indexes the rows of all line tables by address.
+type Lines struct {
+	Tables []*LineTable
+	rows   []LineRow
+}
+
+const (
+	dwLNSCopy             = 0x01
+	dwLNSAdvancePC        = 0x02
+	dwLNSAdvanceLine      = 0x03
+	dwLNSSetFile          = 0x04
+	dwLNSSetColumn        = 0x05
+	dwLNSNegateStmt       = 0x06
+	dwLNSSetBasicBlock    = 0x07
+	dwLNSConstAddPC       = 0x08
+	dwLNSFixedAdvancePC   = 0x09
+	dwLNSSetPrologueEnd   = 0x0a
+	dwLNSSetEpilogueBegin = 0x0b
+	dwLNSSetISA           = 0x0c
+
+	dwLNEEndSequence = 0x01
+	dwLNESetAddress  = 0x02
+	dwLNEDefineFile  = 0x03
+
+	dwLNCTPath           = 0x1
+	dwLNCTDirectoryIndex = 0x2
+
+	dwFormBlock2   = 0x03
+	dwFormBlock4   = 0x04
+	dwFormData2    = 0x05
+	dwFormData4    = 0x06
+	dwFormData8    = 0x07
+	dwFormString   = 0x08
+	dwFormBlock    = 0x09
+	dwFormBlock1   = 0x0a
+	dwFormData1    = 0x0b
+	dwFormSdata    = 0x0d
+	dwFormStrp     = 0x0e
+	dwFormUdata    = 0x0f
+	dwFormData16   = 0x1e
+	dwFormLineStrp = 0x1f
+)
+
+// lineBuf is a cursor over DWARF encoded data. The first error sticks.
+type lineBuf struct {
+	data  []byte
+	order binary.ByteOrder
+	err   error
+}
+
+func (b *lineBuf) bytes(n int) []byte {
+	if b.err != nil || n < 0 || n > len(b.data) {
+		if b.err == nil {
+			b.err = errors.New("unexpected end of line program")
+		}
+		return make([]byte, 8)
+	}
+	r := b.data[:n]
+	b.data = b.data[n:]
+	return r
+}
+
+func (b *lineBuf) u8() uint8   { return b.bytes(1)[0] }
+func (b *lineBuf) u16() uint16 { return b.order.Uint16(b.bytes(2)) }
+func (b *lineBuf) u32() uint32 { return b.order.Uint32(b.bytes(4)) }
+func (b *lineBuf) u64() uint64 { return b.order.Uint64(b.bytes(8)) }
+
+func (b *lineBuf) uint(size int) uint64 {
+	switch size {
+	case 1:
+		return uint64(b.u8())
+	case 2:
+		return uint64(b.u16())
+	case 4:
+		return uint64(b.u32())
+	case 8:
+		return b.u64()
+	}
+	b.bytes(size)
+	return 0
+}
+
+func (b *lineBuf) uleb() uint64 {
+	var x uint64
+	for shift := uint(0); ; shift += 7 {
+		c := b.u8()
+		x |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 || b.err != nil {
+			return x
+		}
+	}
+}
+
+func (b *lineBuf) sleb() int64 {
+	var x int64
+	var shift uint
+	for {
+		c := b.u8()
+		x |= int64(c&0x7f) << shift
+		shift += 7
+		if c&0x80 == 0 || b.err != nil {
+			if shift < 64 && c&0x40 != 0 {
+				x |= -1 << shift
+			}
+			return x
+		}
+	}
+}
+
+func (b *lineBuf) cstring() string {
+	for i, c := range b.data {
+		if c == 0 {
+			s := string(b.data[:i])
+			b.data = b.data[i+1:]
+			return s
+		}
+	}
+	b.bytes(len(b.data) + 1)
+	return ""
+}
+
+// ReadLines decodes the line number programs of all compile units found
+// in .debug_line of the file.
+func ReadLines(f *elf.File) (*Lines, error) {
+	s := DebugSection(f, ".debug_line")
+	if s == nil {
+		return nil, errors.New("no .debug_line section")
+	}
+	data, err := SectionData(f, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var str, lineStr []byte
+	if s := DebugSection(f, ".debug_str"); s != nil {
+		str, _ = SectionData(f, s)
+	}
+	if s := DebugSection(f, ".debug_line_str"); s != nil {
+		lineStr, _ = SectionData(f, s)
+	}
+
+	l := &Lines{}
+	for off := 0; off < len(data); {
+		t, n, err := readLineTable(data[off:], f.ByteOrder, str, lineStr)
+		if err != nil {
+			return nil, fmt.Errorf("read line table at 0x%x failed: %v", off, err)
+		}
+		t.Offset = uint64(off)
+		l.Tables = append(l.Tables, t)
+		l.rows = append(l.rows, t.Rows...)
+		off += n
+	}
+
+	sort.SliceStable(l.rows, func(i, j int) bool {
+		a, b := l.rows[i], l.rows[j]
+		if a.Addr != b.Addr {
+			return a.Addr < b.Addr
+		}
+		return a.EndSequence && !b.EndSequence
+	})
+
+	return l, nil
+}
+
+// PCToLine returns the row describing the instruction at pc.
+func (l *Lines) PCToLine(pc uint64) (LineRow, bool) {
+	i := sort.Search(len(l.rows), func(i int) bool { return l.rows[i].Addr > pc }) - 1
+	// rows ending a sequence at pc sort before the one starting there
+	if i < 0 || l.rows[i].EndSequence {
+		return LineRow{}, false
+	}
+	return l.rows[i], true
+}
+
+// LineToPCs returns the addresses of the statements at the line of the
+// file best matching the given path by trailing components, like the
+// breakpoint locations of dwarf.LineToBreakpointPCs. Of equally matching
+// files the shortest one having code at the line wins.
+func (l *Lines) LineToPCs(file string, line int) ([]uint64, string) {
+	var best []string
+	n := 0
+	seen := map[string]bool{}
+	for _, t := range l.Tables {
+		for _, f := range t.Files {
+			if f == "" || seen[f] {
+				continue
+			}
+			seen[f] = true
+			switch c := matchingPathSuffix(f, file); {
+			case c > n:
+				best, n = []string{f}, c
+			case c == n && c > 0:
+				best = append(best, f)
+			}
+		}
+	}
+	if n == 0 {
+		return nil, ""
+	}
+	sort.Slice(best, func(i, j int) bool { return len(best[i]) < len(best[j]) })
+
+	for _, f := range best {
+		var pcs []uint64
+		for _, r := range l.rows {
+			if r.File == f && r.Line == line && r.IsStmt && !r.EndSequence {
+				if len(pcs) == 0 || pcs[len(pcs)-1] != r.Addr {
+					pcs = append(pcs, r.Addr)
+				}
+			}
+		}
+		if len(pcs) > 0 {
+			return pcs, f
+		}
+	}
+
+	return nil, best[0]
+}
+
+// matchingPathSuffix returns the number of equal trailing components of
+// the paths.
+func matchingPathSuffix(p1, p2 string) int {
+	c1, c2 := strings.Split(p1, "/"), strings.Split(p2, "/")
+	n := 0
+	for n < len(c1) && n < len(c2) && c1[len(c1)-1-n] == c2[len(c2)-1-n] {
+		n++
+	}
+	return n
+}
+
+// readLineTable decodes a single line number program and returns the
+// number of bytes it occupies.
+func readLineTable(data []byte, o binary.ByteOrder, str, lineStr []byte) (*LineTable, int, error) {
+	b := &lineBuf{data: data, order: o}
+
+	offSize := 4
+	length := uint64(b.u32())
+	if length == 0xffffffff {
+		offSize = 8
+		length = b.u64()
+	}
+	if length > uint64(len(b.data)) {
+		return nil, 0, errors.New("bad unit length")
+	}
+	total := len(data) - len(b.data) + int(length)
+	b.data = b.data[:length]
+
+	t := &LineTable{Version: int(b.u16())}
+	if t.Version < 2 || t.Version > 5 {
+		return nil, 0, fmt.Errorf("unsupported version %d", t.Version)
+	}
+
+	addrSize := 0
+	if t.Version >= 5 {
+		addrSize = int(b.u8())
+		b.u8() // segment selector size
+	}
+
+	headerLength := b.uint(offSize)
+	if headerLength > uint64(len(b.data)) {
+		return nil, 0, errors.New("bad header length")
+	}
+	program := b.data[headerLength:]
+
+	minInstLength := uint64(b.u8())
+	maxOps := uint64(1)
+	if t.Version >= 4 {
+		maxOps = uint64(b.u8())
+	}
+	if maxOps == 0 {
+		maxOps = 1
+	}
+	defaultIsStmt := b.u8() != 0
+	lineBase := int(int8(b.u8()))
+	lineRange := int(b.u8())
+	opcodeBase := int(b.u8())
+	if lineRange == 0 || opcodeBase == 0 {
+		return nil, 0, errors.New("bad header")
+	}
+	opcodeLengths := b.bytes(opcodeBase - 1)
+
+	if t.Version >= 5 {
+		form := func(f uint64) (string, uint64) {
+			switch f {
+			case dwFormString:
+				return b.cstring(), 0
+			case dwFormStrp, dwFormLineStrp:
+				sec := str
+				if f == dwFormLineStrp {
+					sec = lineStr
+				}
+				return cstringAt(sec, b.uint(offSize)), 0
+			case dwFormUdata:
+				return "", b.uleb()
+			case dwFormSdata:
+				return "", uint64(b.sleb())
+			case dwFormData1:
+				return "", b.uint(1)
+			case dwFormData2:
+				return "", b.uint(2)
+			case dwFormData4:
+				return "", b.uint(4)
+			case dwFormData8:
+				return "", b.uint(8)
+			case dwFormData16:
+				b.bytes(16)
+			case dwFormBlock:
+				b.bytes(int(b.uleb()))
+			case dwFormBlock1:
+				b.bytes(int(b.u8()))
+			case dwFormBlock2:
+				b.bytes(int(b.u16()))
+			case dwFormBlock4:
+				b.bytes(int(b.u32()))
+			default:
+				if b.err == nil {
+					b.err = fmt.Errorf("unsupported form 0x%x", f)
+				}
+			}
+			return "", 0
+		}
+		entries := func() ([]string, []uint64) {
+			formats := make([][2]uint64, b.u8())
+			for i := range formats {
+				formats[i] = [2]uint64{b.uleb(), b.uleb()}
+			}
+			n := b.uleb()
+			if b.err != nil || n > uint64(len(b.data)) {
+				return nil, nil
+			}
+			names, dirs := make([]string, n), make([]uint64, n)
+			for i := range names {
+				for _, f := range formats {
+					s, v := form(f[1])
+					switch f[0] {
+					case dwLNCTPath:
+						names[i] = s
+					case dwLNCTDirectoryIndex:
+						dirs[i] = v
+					}
+				}
+			}
+			return names, dirs
+		}
+
+		dirs, _ := entries()
+		names, index := entries()
+		for i, name := range names {
+			if index[i] < uint64(len(dirs)) && !path.IsAbs(name) {
+				name = path.Join(dirs[index[i]], name)
+			}
+			t.Files = append(t.Files, name)
+		}
+	} else {
+		dirs := []string{""}
+		for {
+			dir := b.cstring()
+			if dir == "" || b.err != nil {
+				break
+			}
+			dirs = append(dirs, dir)
+		}
+		// file entries are 1-based before DWARF 5
+		t.Files = []string{""}
+		for {
+			name := b.cstring()
+			if name == "" || b.err != nil {
+				break
+			}
+			dir := b.uleb()
+			b.uleb() // mtime
+			b.uleb() // length
+			if dir < uint64(len(dirs)) && !path.IsAbs(name) {
+				name = path.Join(dirs[dir], name)
+			}
+			t.Files = append(t.Files, name)
+		}
+	}
+	if b.err != nil {
+		return nil, 0, b.err
+	}
+
+	b.data = program
+
+	var row LineRow
+	var file, opIndex uint64
+	reset := func() {
+		row = LineRow{Line: 1, IsStmt: defaultIsStmt}
+		file, opIndex = 1, 0
+	}
+	emit := func() {
+		row.File = ""
+		if file < uint64(len(t.Files)) {
+			row.File = t.Files[file]
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	advance := func(n uint64) {
+		row.Addr += minInstLength * ((opIndex + n) / maxOps)
+		opIndex = (opIndex + n) % maxOps
+	}
+
+	reset()
+	for len(b.data) > 0 && b.err == nil {
+		op := int(b.u8())
+		if op >= opcodeBase {
+			adjusted := op - opcodeBase
+			advance(uint64(adjusted / lineRange))
+			row.Line += lineBase + adjusted%lineRange
+			emit()
+			continue
+		}
+
+		switch op {
+		case 0:
+			size := b.uleb()
+			if size == 0 || size > uint64(len(b.data)) {
+				return nil, 0, errors.New("bad extended opcode")
+			}
+			ext := b.bytes(int(size))
+			switch ext[0] {
+			case dwLNEEndSequence:
+				row.EndSequence = true
+				emit()
+				reset()
+			case dwLNESetAddress:
+				eb := &lineBuf{data: ext[1:], order: o}
+				size := len(ext) - 1
+				if addrSize != 0 {
+					size = addrSize
+				}
+				row.Addr = eb.uint(size)
+				opIndex = 0
+			case dwLNEDefineFile:
+				eb := &lineBuf{data: ext[1:], order: o}
+				t.Files = append(t.Files, eb.cstring())
+			}
+		case dwLNSCopy:
+			emit()
+		case dwLNSAdvancePC:
+			advance(b.uleb())
+		case dwLNSAdvanceLine:
+			row.Line += int(b.sleb())
+		case dwLNSSetFile:
+			file = b.uleb()
+		case dwLNSSetColumn:
+			row.Column = int(b.uleb())
+		case dwLNSNegateStmt:
+			row.IsStmt = !row.IsStmt
+		case dwLNSSetBasicBlock, dwLNSSetPrologueEnd, dwLNSSetEpilogueBegin:
+		case dwLNSConstAddPC:
+			advance(uint64((255 - opcodeBase) / lineRange))
+		case dwLNSFixedAdvancePC:
+			row.Addr += uint64(b.u16())
+			opIndex = 0
+		case dwLNSSetISA:
+			b.uleb()
+		default:
+			// skip the arguments of unknown standard opcodes
+			for i := 0; i < int(opcodeLengths[op-1]); i++ {
+				b.uleb()
+			}
+		}
+	}
+	if b.err != nil {
+		return nil, 0, b.err
+	}
+
+	return t, total, nil
+}
+
+func cstringAt(b []byte, off uint64) string {
+	if off >= uint64(len(b)) {
+		return ""
+	}
+	b = b[off:]
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
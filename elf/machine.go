@@ -0,0 +1,9 @@
+package elf
+
+import "golang.org/x/debug/elf"
+
+// Machines missing in the vendored elf package.
+const (
+	EM_AARCH64 elf.Machine = 183 /* ARM 64-bit architecture (AArch64). */
+	EM_RISCV   elf.Machine = 243 /* RISC-V. */
+)
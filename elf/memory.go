@@ -0,0 +1,205 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/debug/elf"
+)
+
+// ErrNotDumped is returned when the address is mapped in the process
+// but its contents were not written into the core file.
+var ErrNotDumped = errors.New("memory is not dumped")
+
+// Mapping is a contiguous range of the process address space.
+type Mapping struct {
+	Start, End uint64
+	Flags      elf.ProgFlag
+
+	// Off is the offset of the mapping in the backing file (if any).
+	Off  uint64
+	File string
+
+	// [Start, Start+Avail) is readable, the rest reads as zeros
+	// or fails with ErrNotDumped.
+	Avail uint64
+
+	// Shared, Anonymous and VmFlags are only known for live processes.
+	Shared bool
+	// Anonymous is the size of the pages not backed by the file, e.g.
+	// the modified pages of a private file mapping.
+	Anonymous uint64
+	// VmFlags are the two letter flags of /proc/<pid>/smaps.
+	VmFlags []string
+
+	r io.ReaderAt
+	// zero reports whether the bytes after Avail are zeros (.bss)
+	// or just missing from the file (core).
+	zero bool
+}
+
+func (m *Mapping) Size() uint64 { return m.End - m.Start }
+
+// HasVmFlag reports whether the smaps flag is set, e.g. "dd" for
+// madvise(MADV_DONTDUMP) or "ht" for hugetlb pages.
+func (m *Mapping) HasVmFlag(f string) bool {
+	for _, x := range m.VmFlags {
+		if x == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mapping) Contains(addr uint64) bool { return addr >= m.Start && addr < m.End }
+
+// Memory is a random access view of a process address space in which
+// offsets are virtual addresses. It is implemented for ELF executables
+// and cores by ProgMemory.
+type Memory interface {
+	io.ReaderAt
+
+	// Mappings returns the memory ranges sorted by start address.
+	Mappings() []*Mapping
+}
+
+// ProgMemory serves memory reads out of the PT_LOAD segments of the file.
+type ProgMemory struct {
+	mappings []*Mapping
+}
+
+// NewProgMemory builds the address space described by PT_LOAD program
+// headers. For executables the part of the segment that is not backed
+// by the file (.bss) reads as zeros, for cores it is reported as not dumped.
+func NewProgMemory(f *elf.File) *ProgMemory {
+	m := &ProgMemory{}
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || p.Memsz == 0 {
+			continue
+		}
+		avail := p.Filesz
+		if avail > p.Memsz {
+			avail = p.Memsz
+		}
+		m.mappings = append(m.mappings, &Mapping{
+			Start: p.Vaddr,
+			End:   p.Vaddr + p.Memsz,
+			Flags: p.Flags,
+			Off:   p.Off,
+			Avail: avail,
+			r:     p,
+			zero:  f.Type != elf.ET_CORE,
+		})
+	}
+	sort.Slice(m.mappings, func(i, j int) bool { return m.mappings[i].Start < m.mappings[j].Start })
+	return m
+}
+
+func (m *ProgMemory) Mappings() []*Mapping { return m.mappings }
+
+func (m *ProgMemory) ReadAt(p []byte, off int64) (int, error) {
+	return readMappings(m.mappings, p, uint64(off))
+}
+
+// FindMapping returns the mapping containing addr.
+func FindMapping(mem Memory, addr uint64) *Mapping {
+	ms := mem.Mappings()
+	i := sort.Search(len(ms), func(i int) bool { return ms[i].End > addr })
+	if i < len(ms) && ms[i].Contains(addr) {
+		return ms[i]
+	}
+	return nil
+}
+
+func readMappings(ms []*Mapping, p []byte, addr uint64) (int, error) {
+	n := 0
+	for n < len(p) {
+		a := addr + uint64(n)
+		i := sort.Search(len(ms), func(i int) bool { return ms[i].End > a })
+		if i == len(ms) || !ms[i].Contains(a) {
+			return n, fmt.Errorf("address 0x%x is not mapped", a)
+		}
+		mp := ms[i]
+
+		chunk := p[n:]
+		if rest := mp.End - a; uint64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+
+		rel := a - mp.Start
+		if rel >= mp.Avail {
+			if !mp.zero {
+				return n, fmt.Errorf("address 0x%x: %v", a, ErrNotDumped)
+			}
+			for i := range chunk {
+				chunk[i] = 0
+			}
+			n += len(chunk)
+			continue
+		}
+
+		if rest := mp.Avail - rel; uint64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		k, err := mp.r.ReadAt(chunk, int64(rel))
+		n += k
+		if err != nil && k < len(chunk) {
+			return n, fmt.Errorf("address 0x%x: %v", a+uint64(k), err)
+		}
+	}
+	return n, nil
+}
+
+// OverlayMemory reads every address from the first layer having it
+// available, e.g. a core backed by the executable for the read-only
+// segments the kernel does not dump.
+type OverlayMemory struct {
+	layers   []Memory
+	mappings []*Mapping
+}
+
+// NewOverlayMemory stacks the layers in the order of precedence.
+func NewOverlayMemory(layers ...Memory) *OverlayMemory {
+	m := &OverlayMemory{layers: layers}
+	for _, l := range layers {
+		for _, mp := range l.Mappings() {
+			overlaps := false
+			for _, o := range m.mappings {
+				if mp.Start < o.End && o.Start < mp.End {
+					overlaps = true
+					break
+				}
+			}
+			if !overlaps {
+				m.mappings = append(m.mappings, mp)
+			}
+		}
+	}
+	sort.Slice(m.mappings, func(i, j int) bool { return m.mappings[i].Start < m.mappings[j].Start })
+	return m
+}
+
+func (m *OverlayMemory) Mappings() []*Mapping { return m.mappings }
+
+func (m *OverlayMemory) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		var k int
+		var err, first error
+		for i, l := range m.layers {
+			if k, err = l.ReadAt(p[n:], off+int64(n)); k > 0 {
+				break
+			}
+			if i == 0 {
+				first = err
+			}
+		}
+		if k == 0 {
+			return n, first
+		}
+		n += k
+	}
+	return n, nil
+}
@@ -0,0 +1,174 @@
+package elf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug/elf"
+)
+
+// SliceHeader is a Go slice header read from the process memory.
+type SliceHeader struct {
+	Data, Len, Cap uint64
+}
+
+// MemReader reads target sized values out of Memory.
+type MemReader struct {
+	Memory
+
+	Order   binary.ByteOrder
+	PtrSize int
+}
+
+func NewMemReader(mem Memory, o binary.ByteOrder, c elf.Class) (*MemReader, error) {
+	r := &MemReader{Memory: mem, Order: o}
+	switch c {
+	case elf.ELFCLASS64:
+		r.PtrSize = 8
+	case elf.ELFCLASS32:
+		r.PtrSize = 4
+	default:
+		return nil, errors.New("unknown elf class")
+	}
+	return r, nil
+}
+
+func (r *MemReader) Bytes(addr uint64, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid read size %d at 0x%x", n, addr)
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, int64(addr)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *MemReader) Uint8(addr uint64) (uint8, error) {
+	b, err := r.Bytes(addr, 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *MemReader) Uint16(addr uint64) (uint16, error) {
+	b, err := r.Bytes(addr, 2)
+	if err != nil {
+		return 0, err
+	}
+	return r.Order.Uint16(b), nil
+}
+
+func (r *MemReader) Uint32(addr uint64) (uint32, error) {
+	b, err := r.Bytes(addr, 4)
+	if err != nil {
+		return 0, err
+	}
+	return r.Order.Uint32(b), nil
+}
+
+func (r *MemReader) Int32(addr uint64) (int32, error) {
+	x, err := r.Uint32(addr)
+	return int32(x), err
+}
+
+func (r *MemReader) Uint64(addr uint64) (uint64, error) {
+	b, err := r.Bytes(addr, 8)
+	if err != nil {
+		return 0, err
+	}
+	return r.Order.Uint64(b), nil
+}
+
+// Uint reads an integer of the given size in bytes.
+func (r *MemReader) Uint(addr uint64, size int) (uint64, error) {
+	switch size {
+	case 1:
+		x, err := r.Uint8(addr)
+		return uint64(x), err
+	case 2:
+		x, err := r.Uint16(addr)
+		return uint64(x), err
+	case 4:
+		x, err := r.Uint32(addr)
+		return uint64(x), err
+	case 8:
+		return r.Uint64(addr)
+	}
+	return 0, fmt.Errorf("invalid integer size %d", size)
+}
+
+// Ptr reads a pointer (uintptr) sized word.
+func (r *MemReader) Ptr(addr uint64) (uint64, error) {
+	return r.Uint(addr, r.PtrSize)
+}
+
+func (r *MemReader) Slice(addr uint64) (SliceHeader, error) {
+	b, err := r.Bytes(addr, 3*r.PtrSize)
+	if err != nil {
+		return SliceHeader{}, err
+	}
+	return SliceHeader{r.word(b), r.word(b[r.PtrSize:]), r.word(b[2*r.PtrSize:])}, nil
+}
+
+// String reads a Go string header and at most limit bytes of its data
+// (limit <= 0 means no limit).
+func (r *MemReader) String(addr uint64, limit int) (string, error) {
+	b, err := r.Bytes(addr, 2*r.PtrSize)
+	if err != nil {
+		return "", err
+	}
+	return r.StringAt(r.word(b), r.word(b[r.PtrSize:]), limit)
+}
+
+// StringAt reads the string data of the given length.
+func (r *MemReader) StringAt(data, size uint64, limit int) (string, error) {
+	if limit > 0 && size > uint64(limit) {
+		size = uint64(limit)
+	}
+	if size == 0 {
+		return "", nil
+	}
+	if size > 1<<30 {
+		return "", fmt.Errorf("invalid string length %d at 0x%x", size, data)
+	}
+	b, err := r.Bytes(data, int(size))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// CString reads a NUL terminated string of at most limit bytes.
+func (r *MemReader) CString(addr uint64, limit int) (string, error) {
+	var s []byte
+	buf := make([]byte, 64)
+	for len(s) < limit {
+		n, err := r.ReadAt(buf, int64(addr)+int64(len(s)))
+		for i := 0; i < n; i++ {
+			if buf[i] == 0 {
+				return string(append(s, buf[:i]...)), nil
+			}
+		}
+		s = append(s, buf[:n]...)
+		if err != nil {
+			return string(s), err
+		}
+	}
+	return string(s[:limit]), nil
+}
+
+func (r *MemReader) word(b []byte) uint64 {
+	if r.PtrSize == 8 {
+		return r.Order.Uint64(b)
+	}
+	return uint64(r.Order.Uint32(b))
+}
+
+// Align rounds x up to a multiple of the pointer size.
+func (r *MemReader) Align(x uint64) uint64 {
+	ps := uint64(r.PtrSize)
+	return (x + ps - 1) &^ (ps - 1)
+}
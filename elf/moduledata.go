@@ -0,0 +1,397 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug/elf"
+)
+
+// ModuleData mirrors runtime.moduledata. Fields missing in a Go
+// release are left zero.
+type ModuleData struct {
+	Addr    uint64
+	Version GoVersion
+
+	PCHeader    uint64
+	FuncNameTab SliceHeader
+	CUTab       SliceHeader
+	FileTab     SliceHeader
+	PCTab       SliceHeader
+	PCLNTable   SliceHeader
+	FTab        SliceHeader
+	FindFuncTab uint64
+	MinPC       uint64
+	MaxPC       uint64
+
+	Text, EText           uint64
+	NoPtrData, ENoPtrData uint64
+	Data, EData           uint64
+	BSS, EBSS             uint64
+	NoPtrBSS, ENoPtrBSS   uint64
+	CovCtrs, ECovCtrs     uint64
+	End, GCData, GCBSS    uint64
+	Types, ETypes         uint64
+	TypeDescLen           uint64
+	ITabOffset, ITabSize  uint64
+	ROData                uint64
+	GoFunc                uint64
+	EPCLNTab              uint64
+
+	TextSectMap SliceHeader
+	TypeLinks   SliceHeader
+	ITabLinks   SliceHeader
+	PTab        SliceHeader
+
+	PluginPath string
+	PkgHashes  SliceHeader
+	InitTasks  SliceHeader
+
+	ModuleName   string
+	ModuleHashes SliceHeader
+
+	HasMain uint8
+	Bad     bool
+
+	GCDataMask, GCBSSMask BitVector
+
+	TypeMap uint64
+	Next    uint64
+}
+
+// BitVector is runtime.bitvector.
+type BitVector struct {
+	N        int32
+	ByteData uint64
+}
+
+// HasTypeLinks reports whether the module lists types and itabs in
+// typelinks/itablinks or lays them out contiguously (typedesclen).
+func (md *ModuleData) HasTypeLinks() bool { return md.TypeDescLen == 0 && md.ITabSize == 0 }
+
+type mdKind int
+
+const (
+	mdPtr mdKind = iota
+	mdSlice
+	mdString
+	mdUint8
+	mdBitVector
+)
+
+type mdField struct {
+	kind mdKind
+	ptr  func(md *ModuleData) interface{}
+}
+
+func mdp(f func(md *ModuleData) *uint64) mdField {
+	return mdField{mdPtr, func(md *ModuleData) interface{} { return f(md) }}
+}
+
+func mds(f func(md *ModuleData) *SliceHeader) mdField {
+	return mdField{mdSlice, func(md *ModuleData) interface{} { return f(md) }}
+}
+
+func mdt(f func(md *ModuleData) *string) mdField {
+	return mdField{mdString, func(md *ModuleData) interface{} { return f(md) }}
+}
+
+// moduleDataLayout returns runtime.moduledata fields in memory order
+// for the given Go release. newTypes selects the layout without
+// typelinks in which type descriptors and itabs are laid out contiguously.
+func moduleDataLayout(v GoVersion, newTypes bool) []mdField {
+	var l []mdField
+
+	if v.AtLeast(16) {
+		l = append(l,
+			mdp(func(md *ModuleData) *uint64 { return &md.PCHeader }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.FuncNameTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.CUTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.FileTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.PCTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.PCLNTable }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.FTab }))
+	} else {
+		l = append(l,
+			mds(func(md *ModuleData) *SliceHeader { return &md.PCLNTable }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.FTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.FileTab }))
+	}
+
+	l = append(l,
+		mdp(func(md *ModuleData) *uint64 { return &md.FindFuncTab }),
+		mdp(func(md *ModuleData) *uint64 { return &md.MinPC }),
+		mdp(func(md *ModuleData) *uint64 { return &md.MaxPC }),
+		mdp(func(md *ModuleData) *uint64 { return &md.Text }),
+		mdp(func(md *ModuleData) *uint64 { return &md.EText }),
+		mdp(func(md *ModuleData) *uint64 { return &md.NoPtrData }),
+		mdp(func(md *ModuleData) *uint64 { return &md.ENoPtrData }),
+		mdp(func(md *ModuleData) *uint64 { return &md.Data }),
+		mdp(func(md *ModuleData) *uint64 { return &md.EData }),
+		mdp(func(md *ModuleData) *uint64 { return &md.BSS }),
+		mdp(func(md *ModuleData) *uint64 { return &md.EBSS }),
+		mdp(func(md *ModuleData) *uint64 { return &md.NoPtrBSS }),
+		mdp(func(md *ModuleData) *uint64 { return &md.ENoPtrBSS }))
+
+	if v.AtLeast(20) {
+		l = append(l,
+			mdp(func(md *ModuleData) *uint64 { return &md.CovCtrs }),
+			mdp(func(md *ModuleData) *uint64 { return &md.ECovCtrs }))
+	}
+
+	l = append(l,
+		mdp(func(md *ModuleData) *uint64 { return &md.End }),
+		mdp(func(md *ModuleData) *uint64 { return &md.GCData }),
+		mdp(func(md *ModuleData) *uint64 { return &md.GCBSS }),
+		mdp(func(md *ModuleData) *uint64 { return &md.Types }))
+
+	if newTypes {
+		l = append(l,
+			mdp(func(md *ModuleData) *uint64 { return &md.TypeDescLen }),
+			mdp(func(md *ModuleData) *uint64 { return &md.ETypes }),
+			mdp(func(md *ModuleData) *uint64 { return &md.ITabOffset }),
+			mdp(func(md *ModuleData) *uint64 { return &md.ITabSize }),
+			mdp(func(md *ModuleData) *uint64 { return &md.ROData }),
+			mdp(func(md *ModuleData) *uint64 { return &md.GoFunc }),
+			mdp(func(md *ModuleData) *uint64 { return &md.EPCLNTab }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.TextSectMap }))
+	} else {
+		l = append(l, mdp(func(md *ModuleData) *uint64 { return &md.ETypes }))
+		if v.AtLeast(18) {
+			l = append(l,
+				mdp(func(md *ModuleData) *uint64 { return &md.ROData }),
+				mdp(func(md *ModuleData) *uint64 { return &md.GoFunc }))
+		}
+		l = append(l,
+			mds(func(md *ModuleData) *SliceHeader { return &md.TextSectMap }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.TypeLinks }),
+			mds(func(md *ModuleData) *SliceHeader { return &md.ITabLinks }))
+	}
+
+	l = append(l,
+		mds(func(md *ModuleData) *SliceHeader { return &md.PTab }),
+		mdt(func(md *ModuleData) *string { return &md.PluginPath }),
+		mds(func(md *ModuleData) *SliceHeader { return &md.PkgHashes }))
+
+	if v.AtLeast(21) {
+		l = append(l, mds(func(md *ModuleData) *SliceHeader { return &md.InitTasks }))
+	}
+
+	l = append(l,
+		mdt(func(md *ModuleData) *string { return &md.ModuleName }),
+		mds(func(md *ModuleData) *SliceHeader { return &md.ModuleHashes }),
+		mdField{mdUint8, func(md *ModuleData) interface{} { return &md.HasMain }})
+
+	bad := mdField{mdUint8, func(md *ModuleData) interface{} { return &md.Bad }}
+	if v.AtLeast(22) {
+		l = append(l, bad)
+	}
+
+	l = append(l,
+		mdField{mdBitVector, func(md *ModuleData) interface{} { return &md.GCDataMask }},
+		mdField{mdBitVector, func(md *ModuleData) interface{} { return &md.GCBSSMask }},
+		mdp(func(md *ModuleData) *uint64 { return &md.TypeMap }))
+
+	if !v.AtLeast(22) {
+		l = append(l, bad)
+	}
+
+	l = append(l, mdp(func(md *ModuleData) *uint64 { return &md.Next }))
+
+	return l
+}
+
+// ReadModuleData decodes runtime.moduledata at addr.
+func ReadModuleData(r *MemReader, addr uint64, v GoVersion, newTypes bool) (*ModuleData, error) {
+	md := &ModuleData{Addr: addr, Version: v}
+
+	off := addr
+	for _, f := range moduleDataLayout(v, newTypes) {
+		var err error
+
+		switch f.kind {
+		case mdPtr:
+			off = r.Align(off)
+			*f.ptr(md).(*uint64), err = r.Ptr(off)
+			off += uint64(r.PtrSize)
+		case mdSlice:
+			off = r.Align(off)
+			*f.ptr(md).(*SliceHeader), err = r.Slice(off)
+			off += 3 * uint64(r.PtrSize)
+		case mdString:
+			off = r.Align(off)
+			*f.ptr(md).(*string), err = r.String(off, 4096)
+			off += 2 * uint64(r.PtrSize)
+		case mdUint8:
+			var x uint8
+			x, err = r.Uint8(off)
+			switch p := f.ptr(md).(type) {
+			case *uint8:
+				*p = x
+			case *bool:
+				*p = x != 0
+			}
+			off++
+		case mdBitVector:
+			off = r.Align(off)
+			bv := f.ptr(md).(*BitVector)
+			if bv.N, err = r.Int32(off); err == nil {
+				bv.ByteData, err = r.Ptr(off + uint64(r.PtrSize))
+			}
+			off += 2 * uint64(r.PtrSize)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("read moduledata at 0x%x failed: %v", off, err)
+		}
+	}
+
+	return md, nil
+}
+
+// ModuleDataVersion picks the Go release of the binary for decoding the
+// runtime structures: from the build info, runtime.buildVersion or, as
+// the last resort, from the pclntab header magic.
+func ModuleDataVersion(f *elf.File, mem Memory, syms []elf.Symbol) (GoVersion, error) {
+	if bi, err := ReadBuildInfo(f, mem); err == nil {
+		if v, err := ParseGoVersion(bi.GoVersion); err == nil {
+			return v, nil
+		}
+	}
+
+	if r, err := NewMemReader(mem, f.ByteOrder, f.Class); err == nil {
+		for _, s := range syms {
+			if s.Name != "runtime.buildVersion" {
+				continue
+			}
+			if str, err := r.String(s.Value, 64); err == nil {
+				if v, err := ParseGoVersion(str); err == nil {
+					return v, nil
+				}
+			}
+		}
+	}
+
+	if s := f.Section(".gopclntab"); s != nil {
+		b := make([]byte, 4)
+		if _, err := s.ReadAt(b, 0); err == nil {
+			switch f.ByteOrder.Uint32(b) {
+			case 0xfffffffb:
+				return GoVersion{1, 12}, nil
+			case 0xfffffffa:
+				return GoVersion{1, 16}, nil
+			case 0xfffffff0:
+				return GoVersion{1, 18}, nil
+			case 0xfffffff1:
+				return GoVersion{1, 20}, nil
+			}
+		}
+	}
+
+	return GoVersion{}, errors.New("unknown go version")
+}
+
+// FindModuleData locates and decodes runtime.firstmoduledata by symbol
+// or, for stripped binaries, by scanning .noptrdata for a pointer to the
+// pclntab header which is the first word of moduledata in every release.
+// Newer linkers place it in a .go.module section of its own.
+func FindModuleData(f *elf.File, mem Memory, syms []elf.Symbol) (*ModuleData, error) {
+	v, err := ModuleDataVersion(f, mem, syms)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewMemReader(mem, f.ByteOrder, f.Class)
+	if err != nil {
+		return nil, err
+	}
+
+	// Since Go 1.26 types are not listed in the .typelink section anymore.
+	newTypes := v.AtLeast(26) && f.Section(".typelink") == nil
+
+	for _, s := range syms {
+		if s.Name == "runtime.firstmoduledata" {
+			return ReadModuleData(r, s.Value, v, newTypes)
+		}
+	}
+
+	pclntab, err := findPCLNTab(f)
+	if err != nil {
+		return nil, fmt.Errorf("runtime.firstmoduledata not found: %v", err)
+	}
+
+	for _, name := range []string{".go.module", ".noptrdata", ".data", ".data.rel.ro"} {
+		s := f.Section(name)
+		if s == nil || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := SectionData(f, s)
+		if err != nil {
+			return nil, err
+		}
+		for off := 0; off+r.PtrSize <= len(data); off += r.PtrSize {
+			if r.word(data[off:]) != pclntab {
+				continue
+			}
+			md, err := ReadModuleData(r, s.Addr+uint64(off), v, newTypes)
+			if err == nil && md.valid(f) {
+				return md, nil
+			}
+		}
+	}
+
+	return nil, errors.New("runtime.firstmoduledata not found")
+}
+
+// valid checks the decoded moduledata is consistent with the file layout.
+func (md *ModuleData) valid(f *elf.File) bool {
+	if md.Text == 0 || md.EText <= md.Text || md.MinPC < md.Text || md.MaxPC > md.EText {
+		return false
+	}
+	if md.ETypes < md.Types || md.End < md.ENoPtrBSS {
+		return false
+	}
+	if t := f.Section(".text"); t != nil && (md.Text < t.Addr || md.Text >= t.Addr+t.Size) {
+		return false
+	}
+	return md.FTab.Len > 0 && md.FTab.Len <= md.FTab.Cap
+}
+
+// findPCLNTab returns the address of the pclntab header: the .gopclntab
+// section or the header magic found in other read-only data as in
+// externally linked PIE binaries.
+func findPCLNTab(f *elf.File) (uint64, error) {
+	if s := f.Section(".gopclntab"); s != nil {
+		return s.Addr, nil
+	}
+
+	ptrSize := byte(8)
+	if f.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_ALLOC == 0 ||
+			s.Flags&elf.SHF_EXECINSTR != 0 {
+			continue
+		}
+		data, err := SectionData(f, s)
+		if err != nil {
+			return 0, err
+		}
+		// pcHeader is aligned to the pointer size
+		for off := 0; off+8 <= len(data); off += int(ptrSize) {
+			switch f.ByteOrder.Uint32(data[off:]) {
+			case 0xfffffffb, 0xfffffffa, 0xfffffff0, 0xfffffff1:
+			default:
+				continue
+			}
+			quantum := data[off+6]
+			if data[off+4] == 0 && data[off+5] == 0 && data[off+7] == ptrSize &&
+				(quantum == 1 || quantum == 2 || quantum == 4) {
+				return s.Addr + uint64(off), nil
+			}
+		}
+	}
+
+	return 0, errors.New("pclntab not found")
+}
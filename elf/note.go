@@ -25,6 +25,10 @@ type Note struct {
 func (n *Note) Open() io.ReadSeeker { return io.NewSectionReader(bytes.NewReader(n.Data), 0, int64(len(n.Data))) }
 
 const (
+	// Notes of the "Go" owner emitted by cmd/link.
+	NT_GO_PKGLIST	NoteType = 0x1
+	NT_GO_ABIHASH	NoteType = 0x2
+	NT_GO_DEPS	NoteType = 0x3
 	NT_GO_BUILD	NoteType = 0x4
 
 	/*
@@ -138,13 +142,107 @@ var shnStrings = []intName{
 func (i NoteType) String() string   { return stringName(uint32(i), shnStrings, false) }
 func (i NoteType) GoString() string { return stringName(uint32(i), shnStrings, true) }
 
+var goNoteStrings = []intName{
+	{0x1, "NT_GO_PKGLIST"},
+	{0x2, "NT_GO_ABIHASH"},
+	{0x3, "NT_GO_DEPS"},
+	{0x4, "NT_GO_BUILDID"},
+}
+
+const (
+	NT_FREEBSD_ABI_TAG	NoteType = 0x1
+	NT_FREEBSD_NOINIT_TAG	NoteType = 0x2
+	NT_FREEBSD_ARCH_TAG	NoteType = 0x3
+	NT_FREEBSD_FEATURE_CTL	NoteType = 0x4
+)
+
+var freebsdNoteStrings = []intName{
+	{0x1, "NT_FREEBSD_ABI_TAG"},
+	{0x2, "NT_FREEBSD_NOINIT_TAG"},
+	{0x3, "NT_FREEBSD_ARCH_TAG"},
+	{0x4, "NT_FREEBSD_FEATURE_CTL"},
+}
+
+// Note types are only unique within the namespace of the note owner,
+// i.e. type 3 is NT_PRPSINFO for "CORE" but NT_GNU_BUILD_ID for "GNU".
+func noteStrings(owner string) []intName {
+	switch owner {
+	case "GNU":
+		return gnuNoteStrings
+	case "Go":
+		return goNoteStrings
+	case "FreeBSD":
+		return freebsdNoteStrings
+	case "CORE", "LINUX":
+		return shnStrings
+	}
+	return nil
+}
+
+// TypeString returns the note type name interpreted according
+// to the note owner name.
+func (n *Note) TypeString() string {
+	names := noteStrings(n.Name)
+	for _, x := range names {
+		if x.i == uint32(n.Type) {
+			return x.s
+		}
+	}
+	return "0x" + strconv.FormatUint(uint64(n.Type), 16)
+}
+
 func ReadNotes(s *elf.Section, o binary.ByteOrder) ([]*Note, error) {
 	if s.Type != elf.SHT_NOTE {
 		return []*Note{}, fmt.Errorf("invalid section type: %v/%v", s.Name, s.Type)
 	}
 
+	return readNotes(s.Open(), o)
+}
+
+// ReadProgNotes reads notes of the PT_NOTE segment. Core files usually
+// come without section headers, so that is the only way to get them.
+func ReadProgNotes(p *elf.Prog, o binary.ByteOrder) ([]*Note, error) {
+	if p.Type != elf.PT_NOTE {
+		return []*Note{}, fmt.Errorf("invalid prog type: %v", p.Type)
+	}
+
+	return readNotes(io.NewSectionReader(p, 0, int64(p.Filesz)), o)
+}
+
+// ReadAllNotes collects notes from every SHT_NOTE section of the file
+// or, if there are no note sections, from every PT_NOTE segment.
+func ReadAllNotes(f *elf.File) ([]*Note, error) {
+	notes := []*Note{}
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		n, err := ReadNotes(s, f.ByteOrder)
+		if err != nil {
+			return notes, fmt.Errorf("%v: %v", s.Name, err)
+		}
+		notes = append(notes, n...)
+	}
+	if len(notes) > 0 {
+		return notes, nil
+	}
+
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_NOTE {
+			continue
+		}
+		n, err := ReadProgNotes(p, f.ByteOrder)
+		if err != nil {
+			return notes, fmt.Errorf("%v at 0x%x: %v", p.Type, p.Off, err)
+		}
+		notes = append(notes, n...)
+	}
+
+	return notes, nil
+}
+
+func readNotes(r io.Reader, o binary.ByteOrder) ([]*Note, error) {
 	notes := []*Note{}
-	r := s.Open()
 	for {
 		note := &Note{}
 
@@ -188,6 +286,22 @@ func ReadNotes(s *elf.Section, o binary.ByteOrder) ([]*Note, error) {
 	return notes, nil
 }
 
+// EncodeNotes lays out the notes as in a SHT_NOTE section or PT_NOTE
+// segment: the header, the NUL terminated name and the descriptor, each
+// padded to 4 bytes.
+func EncodeNotes(notes []*Note, o binary.ByteOrder) []byte {
+	b := &bytes.Buffer{}
+	for _, n := range notes {
+		name := append([]byte(n.Name), 0)
+		binary.Write(b, o, [3]uint32{uint32(len(name)), uint32(len(n.Data)), uint32(n.Type)})
+		b.Write(name)
+		b.Write(make([]byte, (len(name)+3)&^3-len(name)))
+		b.Write(n.Data)
+		b.Write(make([]byte, (len(n.Data)+3)&^3-len(n.Data)))
+	}
+	return b.Bytes()
+}
+
 func ReadNoteByType(s *elf.Section, o binary.ByteOrder, search NoteType) (*Note, error) {
 	if s.Type != elf.SHT_NOTE {
 		return nil, fmt.Errorf("invalid section type: %v/%v", s.Name, s.Type)
@@ -0,0 +1,304 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// FuncTab decodes the function table of pclntab (Go 1.16+) for the
+// frame sizes needed to unwind stacks. debug/gosym does not expose them.
+type FuncTab struct {
+	data    []byte
+	order   binary.ByteOrder
+	ptrSize int
+	minLC   uint64
+	nfunc   int
+	// Go 1.18+ keeps entries as 32-bit offsets from textStart
+	offsets   bool
+	textStart uint64
+	// go120 is the layout of _func and inlinedCall of Go 1.20+
+	go120 bool
+
+	// GoFunc is the address of go:func.*, the base of funcdata offsets
+	// since Go 1.18 (moduledata.gofunc). Inlined calls are not expanded
+	// without it.
+	GoFunc uint64
+
+	funcnametab, pctab, ftab []byte
+}
+
+// Func is an entry of the function table.
+type Func struct {
+	Entry uint64
+	Name  string
+	// End is the entry of the next function.
+	End uint64
+
+	pcsp uint32
+	// raw is _func, hdr is the offset of its pcdata
+	raw                []byte
+	hdr                int
+	npcdata, nfuncdata int
+}
+
+// the indexes of the pcdata and funcdata tables of inlining and of the
+// argument area
+const (
+	pcdataInlTreeIndex  = 2
+	pcdataArgLiveIndex  = 3
+	funcdataInlTree     = 3
+	funcdataArgInfo     = 5
+	funcdataArgLiveInfo = 6
+)
+
+// NewFuncTab parses the pclntab header. text is the address of .text,
+// used if the header does not have it (Go 1.26+), like gosym.NewLineTable.
+func NewFuncTab(data []byte, text uint64) (*FuncTab, error) {
+	if len(data) < 8 {
+		return nil, errors.New("pclntab is too short")
+	}
+	t := &FuncTab{data: data, order: binary.LittleEndian}
+	magic := binary.LittleEndian.Uint32(data)
+	if magic&0xfff0 != 0xfff0 {
+		t.order = binary.BigEndian
+		magic = binary.BigEndian.Uint32(data)
+	}
+	switch magic {
+	case 0xfffffffa:
+	case 0xfffffff0:
+		t.offsets = true
+	case 0xfffffff1:
+		t.offsets, t.go120 = true, true
+	default:
+		return nil, fmt.Errorf("unsupported pclntab magic 0x%x", magic)
+	}
+	t.minLC, t.ptrSize = uint64(data[6]), int(data[7])
+	if t.ptrSize != 4 && t.ptrSize != 8 {
+		return nil, fmt.Errorf("invalid pclntab pointer size %d", t.ptrSize)
+	}
+
+	// nfunc, nfiles, [textStart], funcnametab, cutab, filetab, pctab, pclntab
+	word := func(i int) uint64 {
+		off := 8 + i*t.ptrSize
+		if off+t.ptrSize > len(data) {
+			return 0
+		}
+		return t.word(data[off:])
+	}
+	t.nfunc = int(word(0))
+	i := 2
+	if t.offsets {
+		if t.textStart = word(2); t.textStart == 0 {
+			t.textStart = text
+		}
+		i++
+	}
+	funcnameOff, pctabOff, pclnOff := word(i), word(i+3), word(i+4)
+	if funcnameOff > uint64(len(data)) || pctabOff > uint64(len(data)) || pclnOff > uint64(len(data)) {
+		return nil, errors.New("invalid pclntab header offsets")
+	}
+	t.funcnametab, t.pctab, t.ftab = data[funcnameOff:], data[pctabOff:], data[pclnOff:]
+
+	if uint64(t.nfunc+1)*uint64(t.ftabEntrySize()) > uint64(len(t.ftab)) {
+		return nil, errors.New("function table is out of pclntab")
+	}
+	return t, nil
+}
+
+func (t *FuncTab) word(b []byte) uint64 {
+	if t.ptrSize == 8 {
+		return t.order.Uint64(b)
+	}
+	return uint64(t.order.Uint32(b))
+}
+
+func (t *FuncTab) ftabEntrySize() int {
+	if t.offsets {
+		return 8
+	}
+	return 2 * t.ptrSize
+}
+
+// ftabEntry returns the entry pc and the offset of _func of the i-th
+// function.
+func (t *FuncTab) ftabEntry(i int) (uint64, uint64) {
+	b := t.ftab[i*t.ftabEntrySize():]
+	if t.offsets {
+		return t.textStart + uint64(t.order.Uint32(b)), uint64(t.order.Uint32(b[4:]))
+	}
+	return t.word(b), t.word(b[t.ptrSize:])
+}
+
+// FuncForPC returns the function containing pc.
+func (t *FuncTab) FuncForPC(pc uint64) (*Func, bool) {
+	if t.nfunc == 0 {
+		return nil, false
+	}
+	if first, _ := t.ftabEntry(0); pc < first {
+		return nil, false
+	}
+	if end, _ := t.ftabEntry(t.nfunc); pc >= end {
+		return nil, false
+	}
+	i := sort.Search(t.nfunc, func(i int) bool {
+		entry, _ := t.ftabEntry(i)
+		return entry > pc
+	}) - 1
+
+	entry, off := t.ftabEntry(i)
+	end, _ := t.ftabEntry(i + 1)
+	if off+44 > uint64(len(t.ftab)) {
+		return nil, false
+	}
+	// _func: entry, nameOff, args, deferreturn, pcsp, pcfile, pcln,
+	// npcdata, cuOffset, [startLine,] funcID, flag, _, nfuncdata, then
+	// pcdata and funcdata
+	raw := t.ftab[off:]
+	b := raw
+	hdr := 40
+	if !t.offsets {
+		b = b[t.ptrSize-4:]
+		hdr = t.ptrSize + 36
+	} else if t.go120 {
+		hdr = 44
+	}
+	f := &Func{
+		Entry:     entry,
+		End:       end,
+		pcsp:      t.order.Uint32(b[16:]),
+		raw:       raw,
+		hdr:       hdr,
+		npcdata:   int(t.order.Uint32(b[28:])),
+		nfuncdata: int(raw[hdr-1]),
+	}
+	f.Name = t.funcName(t.order.Uint32(b[4:]))
+	return f, true
+}
+
+func (t *FuncTab) funcName(off uint32) string {
+	if uint64(off) >= uint64(len(t.funcnametab)) {
+		return ""
+	}
+	name := t.funcnametab[off:]
+	if k := bytes.IndexByte(name, 0); k >= 0 {
+		name = name[:k]
+	}
+	return string(name)
+}
+
+// pcdata returns the offset of the i-th pc-value table of f, 0 if f
+// does not have it.
+func (t *FuncTab) pcdata(f *Func, i int) uint32 {
+	off := f.hdr + 4*i
+	if i >= f.npcdata || off+4 > len(f.raw) {
+		return 0
+	}
+	return t.order.Uint32(f.raw[off:])
+}
+
+// funcdata returns the address of the i-th funcdata of f.
+func (t *FuncTab) funcdata(f *Func, i int) (uint64, bool) {
+	if i >= f.nfuncdata {
+		return 0, false
+	}
+	off := f.hdr + 4*f.npcdata
+	if !t.offsets {
+		// pointers aligned in the _func
+		off = (off + t.ptrSize - 1) &^ (t.ptrSize - 1)
+		off += i * t.ptrSize
+		if off+t.ptrSize > len(f.raw) {
+			return 0, false
+		}
+		p := t.word(f.raw[off:])
+		return p, p != 0
+	}
+	off += 4 * i
+	if off+4 > len(f.raw) || t.GoFunc == 0 {
+		return 0, false
+	}
+	v := t.order.Uint32(f.raw[off:])
+	if v == ^uint32(0) {
+		return 0, false
+	}
+	return t.GoFunc + uint64(v), true
+}
+
+// InlinedCall is an entry of the inline tree of a function: the function
+// inlined and the pc of the call in its caller, relative to the entry of
+// the outermost function.
+type InlinedCall struct {
+	Name     string
+	ParentPC uint64
+}
+
+// InlinedAt returns the innermost call inlined at pc in f. The inline
+// tree is in the memory of the binary.
+func (t *FuncTab) InlinedAt(r *MemReader, f *Func, pc uint64) (*InlinedCall, bool) {
+	table := t.pcdata(f, pcdataInlTreeIndex)
+	if table == 0 {
+		return nil, false
+	}
+	tree, ok := t.funcdata(f, funcdataInlTree)
+	if !ok {
+		return nil, false
+	}
+	i, ok := t.pcValue(table, f.Entry, pc)
+	if !ok || i < 0 {
+		return nil, false
+	}
+
+	// inlinedCall: funcID, _ [3]byte, nameOff, parentPc, startLine since
+	// Go 1.20, parent int16, funcID, _, file, line, func, parentPc before
+	size, nameAt, parentAt := uint64(20), uint64(12), uint64(16)
+	if t.go120 {
+		size, nameAt, parentAt = 16, 4, 8
+	}
+	b, err := r.Bytes(tree+uint64(i)*size, int(size))
+	if err != nil {
+		return nil, false
+	}
+	return &InlinedCall{
+		Name:     t.funcName(t.order.Uint32(b[nameAt:])),
+		ParentPC: uint64(t.order.Uint32(b[parentAt:])),
+	}, true
+}
+
+// SPDelta returns the size of the frame of f allocated at pc, i.e. the
+// distance from the stack pointer to the return address.
+func (t *FuncTab) SPDelta(f *Func, pc uint64) (int64, bool) {
+	return t.pcValue(f.pcsp, f.Entry, pc)
+}
+
+// pcValue decodes the pc-value table at off: pairs of zig-zag encoded
+// value and pc deltas.
+func (t *FuncTab) pcValue(off uint32, entry, target uint64) (int64, bool) {
+	if off == 0 || uint64(off) >= uint64(len(t.pctab)) {
+		return 0, false
+	}
+	p := t.pctab[off:]
+	val, pc := int64(-1), entry
+	for first := true; ; first = false {
+		uv, n := binary.Uvarint(p)
+		if n <= 0 || (uv == 0 && !first) {
+			return 0, false
+		}
+		p = p[n:]
+		if uv&1 != 0 {
+			val += -int64(uv>>1) - 1
+		} else {
+			val += int64(uv >> 1)
+		}
+		pcDelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, false
+		}
+		p = p[n:]
+		pc += pcDelta * t.minLC
+		if target < pc {
+			return val, true
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package elf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+// ProcMemory reads the memory of a live process from /proc/<pid>/mem.
+// Reads are not synchronized with the process, so the data of a running
+// program can be inconsistent.
+type ProcMemory struct {
+	Pid int
+
+	f        *os.File
+	mappings []*Mapping
+}
+
+// NewProcMemory opens the address space of the process. Reading it needs
+// the ptrace access to the process.
+func NewProcMemory(pid int) (*ProcMemory, error) {
+	ms, err := ReadProcMaps(pid)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(procPath(pid, "mem"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &ProcMemory{Pid: pid, f: f}
+	for _, mp := range ms {
+		// [vsyscall] is above the offsets /proc/<pid>/mem can seek to
+		if mp.End > 1<<63 {
+			continue
+		}
+		mp.Avail = mp.Size()
+		mp.r = io.NewSectionReader(f, int64(mp.Start), int64(mp.Size()))
+		m.mappings = append(m.mappings, mp)
+	}
+
+	return m, nil
+}
+
+func (m *ProcMemory) Mappings() []*Mapping { return m.mappings }
+
+func (m *ProcMemory) ReadAt(p []byte, off int64) (int, error) {
+	return readMappings(m.mappings, p, uint64(off))
+}
+
+func (m *ProcMemory) Close() error { return m.f.Close() }
+
+// ReadProcMaps parses /proc/<pid>/maps:
+//
+//	00400000-0048e000 r-xp 00000000 fd:01 1234     /usr/bin/prog
+func ReadProcMaps(pid int) ([]*Mapping, error) {
+	return readProcMaps(pid, "maps")
+}
+
+// ReadProcSmaps parses /proc/<pid>/smaps, the maps lines followed by
+// the statistics of the mapping. The size of the anonymous pages and
+// the VmFlags are kept.
+func ReadProcSmaps(pid int) ([]*Mapping, error) {
+	return readProcMaps(pid, "smaps")
+}
+
+func readProcMaps(pid int, name string) ([]*Mapping, error) {
+	f, err := os.Open(procPath(pid, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ms []*Mapping
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) == 0 {
+			continue
+		}
+
+		// smaps attributes are "Key: value"
+		if strings.HasSuffix(fs[0], ":") && len(ms) > 0 {
+			mp := ms[len(ms)-1]
+			switch fs[0] {
+			case "Anonymous:":
+				if len(fs) >= 2 {
+					kb, _ := strconv.ParseUint(fs[1], 10, 64)
+					mp.Anonymous = kb << 10
+				}
+			case "VmFlags:":
+				mp.VmFlags = fs[1:]
+			}
+			continue
+		}
+
+		mp, err := parseMapsLine(fs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v line %q: %v", name, sc.Text(), err)
+		}
+		ms = append(ms, mp)
+	}
+
+	return ms, sc.Err()
+}
+
+func parseMapsLine(fs []string) (*Mapping, error) {
+	if len(fs) < 5 {
+		return nil, errors.New("too few fields")
+	}
+	addrs := strings.SplitN(fs[0], "-", 2)
+	if len(addrs) != 2 {
+		return nil, errors.New("invalid range")
+	}
+
+	var err error
+	mp := &Mapping{}
+	if mp.Start, err = strconv.ParseUint(addrs[0], 16, 64); err != nil {
+		return nil, err
+	}
+	if mp.End, err = strconv.ParseUint(addrs[1], 16, 64); err != nil {
+		return nil, err
+	}
+	if mp.Off, err = strconv.ParseUint(fs[2], 16, 64); err != nil {
+		return nil, err
+	}
+	for _, c := range fs[1] {
+		switch c {
+		case 'r':
+			mp.Flags |= elf.PF_R
+		case 'w':
+			mp.Flags |= elf.PF_W
+		case 'x':
+			mp.Flags |= elf.PF_X
+		case 's':
+			mp.Shared = true
+		}
+	}
+	if len(fs) > 5 {
+		mp.File = strings.Join(fs[5:], " ")
+	}
+
+	return mp, nil
+}
+
+// ReadProcDumpFilter returns /proc/<pid>/coredump_filter.
+func ReadProcDumpFilter(pid int) (DumpFilter, error) {
+	data, err := ioutil.ReadFile(procPath(pid, "coredump_filter"))
+	if err != nil {
+		return 0, err
+	}
+	x, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 32)
+	return DumpFilter(x), err
+}
+
+// ReadProcAuxv returns the auxiliary vector of the process. Its words
+// have the byte order and class of the process executable.
+func ReadProcAuxv(pid int, o binary.ByteOrder, c elf.Class) ([]Auxv, error) {
+	data, err := ioutil.ReadFile(procPath(pid, "auxv"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseAuxv(data, o, c)
+}
+
+// ProcStat is the part of /proc/<pid>/task/<tid>/stat describing the
+// thread in cores. Times are in clock ticks.
+type ProcStat struct {
+	Comm    string
+	State   byte
+	PPid    int
+	PGrp    int
+	Session int
+	Flags   uint64
+	UTime   uint64
+	STime   uint64
+	CUTime  uint64
+	CSTime  uint64
+	Nice    int
+}
+
+// ReadProcStat parses the stat file of the thread of the process.
+func ReadProcStat(pid, tid int) (*ProcStat, error) {
+	data, err := ioutil.ReadFile(procPath(pid, "task/"+strconv.Itoa(tid)+"/stat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// comm can contain spaces and parentheses
+	s := string(data)
+	l, r := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if l < 0 || r < l {
+		return nil, fmt.Errorf("invalid stat of %d/%d", pid, tid)
+	}
+	fs := strings.Fields(s[r+1:])
+	if len(fs) < 17 || len(fs[0]) != 1 {
+		return nil, fmt.Errorf("invalid stat of %d/%d", pid, tid)
+	}
+
+	st := &ProcStat{Comm: s[l+1 : r], State: fs[0][0]}
+	num := func(i int) int64 {
+		n, _ := strconv.ParseInt(fs[i], 10, 64)
+		return n
+	}
+	st.PPid, st.PGrp, st.Session = int(num(1)), int(num(2)), int(num(3))
+	st.Flags = uint64(num(6))
+	st.UTime, st.STime = uint64(num(11)), uint64(num(12))
+	st.CUTime, st.CSTime = uint64(num(13)), uint64(num(14))
+	st.Nice = int(num(16))
+
+	return st, nil
+}
+
+// ReadProcIDs returns the real user and group ids of the process.
+func ReadProcIDs(pid int) (uid, gid uint32, err error) {
+	data, err := ioutil.ReadFile(procPath(pid, "status"))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fs := strings.Fields(line)
+		if len(fs) < 2 {
+			continue
+		}
+		n, _ := strconv.ParseUint(fs[1], 10, 32)
+		switch fs[0] {
+		case "Uid:":
+			uid = uint32(n)
+		case "Gid:":
+			gid = uint32(n)
+		}
+	}
+	return uid, gid, nil
+}
+
+func procPath(pid int, name string) string {
+	return "/proc/" + strconv.Itoa(pid) + "/" + name
+}
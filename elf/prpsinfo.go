@@ -1,6 +1,7 @@
 package elf
 
 import (
+	"bytes"
 	"fmt"
 	"encoding/binary"
 
@@ -91,12 +92,13 @@ func ReadPRPSInfo(n *Note, o binary.ByteOrder, c elf.Class) (*PRPSInfo, error) {
 		return nil, fmt.Errorf("read nice failed: %v", err)
 	}
 
-	if prps.Flag, err = readUInt(r, o, c); err != nil {
-		return nil, fmt.Errorf("read flag failed: %v", err)
-	}
+	// pr_flag is aligned to long
 	if c == elf.ELFCLASS64 {
 		r.Seek(4, io.SeekCurrent)
 	}
+	if prps.Flag, err = readUInt(r, o, c); err != nil {
+		return nil, fmt.Errorf("read flag failed: %v", err)
+	}
 
 	if prps.UID, err = readKernelUid(r, o, c); err != nil {
 		return nil, fmt.Errorf("read uid failed: %v", err)
@@ -135,3 +137,37 @@ func ReadPRPSInfo(n *Note, o binary.ByteOrder, c elf.Class) (*PRPSInfo, error) {
 	return prps, nil
 }
 
+
+// EncodePRPSInfo encodes NT_PRPSINFO, the inverse of ReadPRPSInfo.
+func EncodePRPSInfo(prps *PRPSInfo, o binary.ByteOrder, c elf.Class) ([]byte, error) {
+	if c != elf.ELFCLASS32 && c != elf.ELFCLASS64 {
+		return nil, errors.New("unknown elf class")
+	}
+
+	var sname byte
+	if len(prps.SName) > 0 {
+		sname = prps.SName[0]
+	}
+	var fname [16]byte
+	copy(fname[:], prps.FName)
+	// psargs is NUL terminated
+	var psargs [ELF_PRARGSZ]byte
+	copy(psargs[:ELF_PRARGSZ-1], prps.PSArgs)
+
+	b := &bytes.Buffer{}
+	b.Write([]byte{prps.State, sname, prps.Zomb, prps.Nice})
+	if c == elf.ELFCLASS64 {
+		b.Write(make([]byte, 4))
+	}
+	writeUInt(b, o, c, uint64(prps.Flag))
+	if c == elf.ELFCLASS64 {
+		binary.Write(b, o, [2]uint32{uint32(prps.UID), uint32(prps.GID)})
+	} else {
+		binary.Write(b, o, [2]uint16{uint16(prps.UID), uint16(prps.GID)})
+	}
+	binary.Write(b, o, [4]KernelPid{prps.PID, prps.PPID, prps.PGRP, prps.SID})
+	b.Write(fname[:])
+	b.Write(psargs[:])
+
+	return b.Bytes(), nil
+}
@@ -1,6 +1,7 @@
 package elf
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -103,6 +104,16 @@ func readUInt(r io.Reader, o binary.ByteOrder, c elf.Class) (uint, error) {
 	}
 }
 
+// timeval has the size of long.
+func readTimeVal(r io.Reader, o binary.ByteOrder, c elf.Class) (TimeVal, error) {
+	sec, err := readInt(r, o, c)
+	if err != nil {
+		return TimeVal{}, err
+	}
+	usec, err := readInt(r, o, c)
+	return TimeVal{KernelTime(sec), KernelSUSeconds(usec)}, err
+}
+
 func ReadPRStatus(n *Note, o binary.ByteOrder, c elf.Class) (*PRStatus, error) {
 	if n.Type != NT_PRSTATUS {
 		return nil, fmt.Errorf("invalid note type: %v", n)
@@ -148,32 +159,20 @@ func ReadPRStatus(n *Note, o binary.ByteOrder, c elf.Class) (*PRStatus, error) {
 		return nil, fmt.Errorf("read sid failed: %v", err)
 	}
 
-	if err = binary.Read(r, o, &prs.UTime.Sec); err != nil {
-		return nil, fmt.Errorf("read utime.sec failed: %v", err)
-	}
-	if err = binary.Read(r, o, &prs.UTime.USec); err != nil {
-		return nil, fmt.Errorf("read utime.usec failed: %v", err)
+	if prs.UTime, err = readTimeVal(r, o, c); err != nil {
+		return nil, fmt.Errorf("read utime failed: %v", err)
 	}
 
-	if err = binary.Read(r, o, &prs.STime.Sec); err != nil {
-		return nil, fmt.Errorf("read stime.sec failed: %v", err)
-	}
-	if err = binary.Read(r, o, &prs.STime.USec); err != nil {
-		return nil, fmt.Errorf("read stime.usec failed: %v", err)
+	if prs.STime, err = readTimeVal(r, o, c); err != nil {
+		return nil, fmt.Errorf("read stime failed: %v", err)
 	}
 
-	if err = binary.Read(r, o, &prs.CUTime.Sec); err != nil {
-		return nil, fmt.Errorf("read cutime.sec failed: %v", err)
-	}
-	if err = binary.Read(r, o, &prs.CUTime.USec); err != nil {
-		return nil, fmt.Errorf("read cutime.usec failed: %v", err)
+	if prs.CUTime, err = readTimeVal(r, o, c); err != nil {
+		return nil, fmt.Errorf("read cutime failed: %v", err)
 	}
 
-	if err = binary.Read(r, o, &prs.CSTime.Sec); err != nil {
-		return nil, fmt.Errorf("read cstime.sec failed: %v", err)
-	}
-	if err = binary.Read(r, o, &prs.CSTime.USec); err != nil {
-		return nil, fmt.Errorf("read cstime.usec failed: %v", err)
+	if prs.CSTime, err = readTimeVal(r, o, c); err != nil {
+		return nil, fmt.Errorf("read cstime failed: %v", err)
 	}
 
 	if c == elf.ELFCLASS64 {
@@ -199,3 +198,93 @@ func ReadPRStatus(n *Note, o binary.ByteOrder, c elf.Class) (*PRStatus, error) {
 	return prs, nil
 }
 
+
+// SigInfo is the siginfo_t of NT_SIGINFO. Addr is the faulting address
+// of SIGSEGV, SIGBUS, SIGILL and SIGFPE.
+type SigInfo struct {
+	Signo int32
+	Errno int32
+	Code  int32
+	Addr  uint64
+}
+
+// siginfo_t is padded to 128 bytes.
+const sigInfoSize = 128
+
+// EncodeSigInfo encodes NT_SIGINFO.
+func EncodeSigInfo(si *SigInfo, o binary.ByteOrder, c elf.Class) ([]byte, error) {
+	b := &bytes.Buffer{}
+	binary.Write(b, o, [3]int32{si.Signo, si.Errno, si.Code})
+	if c == elf.ELFCLASS64 {
+		// the union is aligned to 8
+		b.Write(make([]byte, 4))
+	}
+	if err := writeUInt(b, o, c, si.Addr); err != nil {
+		return nil, err
+	}
+	b.Write(make([]byte, sigInfoSize-b.Len()))
+	return b.Bytes(), nil
+}
+
+// ReadSigInfo decodes NT_SIGINFO.
+func ReadSigInfo(n *Note, o binary.ByteOrder, c elf.Class) (*SigInfo, error) {
+	if n.Type != NT_SIGINFO {
+		return nil, fmt.Errorf("invalid note type: %v", n)
+	}
+
+	r := n.Open()
+	si := &SigInfo{}
+	var x [3]int32
+	if err := binary.Read(r, o, &x); err != nil {
+		return nil, fmt.Errorf("read siginfo failed: %v", err)
+	}
+	si.Signo, si.Errno, si.Code = x[0], x[1], x[2]
+	if c == elf.ELFCLASS64 {
+		r.Seek(4, io.SeekCurrent)
+	}
+	addr, err := readUInt(r, o, c)
+	if err != nil {
+		return nil, fmt.Errorf("read addr failed: %v", err)
+	}
+	si.Addr = uint64(addr)
+
+	return si, nil
+}
+
+// EncodePRStatus encodes NT_PRSTATUS, the inverse of ReadPRStatus.
+func EncodePRStatus(prs *PRStatus, o binary.ByteOrder, c elf.Class) ([]byte, error) {
+	if c != elf.ELFCLASS32 && c != elf.ELFCLASS64 {
+		return nil, errors.New("unknown elf class")
+	}
+
+	b := &bytes.Buffer{}
+	binary.Write(b, o, [3]int32{prs.Info.Sig, prs.Info.Code, prs.Info.Err})
+	binary.Write(b, o, prs.CurSig)
+	b.Write(make([]byte, 2))
+	writeUInt(b, o, c, uint64(prs.SigPend))
+	writeUInt(b, o, c, uint64(prs.SigHold))
+	binary.Write(b, o, [4]KernelPid{prs.PID, prs.PPID, prs.PGRP, prs.SID})
+	for _, tv := range []TimeVal{prs.UTime, prs.STime, prs.CUTime, prs.CSTime} {
+		writeUInt(b, o, c, uint64(tv.Sec))
+		writeUInt(b, o, c, uint64(tv.USec))
+	}
+	for _, reg := range prs.Regs {
+		writeUInt(b, o, c, uint64(reg))
+	}
+	// pr_fpvalid, padded to long on 64-bit
+	binary.Write(b, o, int32(1))
+	if c == elf.ELFCLASS64 {
+		b.Write(make([]byte, 4))
+	}
+
+	return b.Bytes(), nil
+}
+
+func writeUInt(w io.Writer, o binary.ByteOrder, c elf.Class, x uint64) error {
+	if c == elf.ELFCLASS64 {
+		return binary.Write(w, o, x)
+	} else if c == elf.ELFCLASS32 {
+		return binary.Write(w, o, uint32(x))
+	}
+	return errors.New("unknown elf class")
+}
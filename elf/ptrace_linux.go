@@ -0,0 +1,177 @@
+package elf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	_PTRACE_GETREGSET = 0x4204
+	_PTRACE_SEIZE     = 0x4206
+	_PTRACE_INTERRUPT = 0x4207
+
+	_PTRACE_EVENT_STOP = 128
+)
+
+// TraceeThread is a thread of a stopped process.
+type TraceeThread struct {
+	Tid  int
+	Regs ElfGRegSet
+	// FPRegs is the NT_PRFPREG register set, nil if not available.
+	FPRegs []byte
+
+	// signal to deliver on detach
+	sig syscall.Signal
+}
+
+// Tracee is a process with all of its threads stopped by ptrace.
+type Tracee struct {
+	Pid     int
+	Threads []*TraceeThread
+}
+
+// SeizeProcess seizes and interrupts every thread of the process and
+// reads their registers. ptrace requests are bound to the OS thread of
+// the tracer, so the calling goroutine is locked to its thread until
+// Detach.
+func SeizeProcess(pid int) (*Tracee, error) {
+	runtime.LockOSThread()
+
+	t := &Tracee{Pid: pid}
+	seized := map[int]bool{}
+
+	// threads can be started while we seize the others
+	for {
+		tids, err := procTasks(pid)
+		if err != nil {
+			t.Detach()
+			return nil, err
+		}
+
+		added := false
+		for _, tid := range tids {
+			if seized[tid] {
+				continue
+			}
+			seized[tid] = true
+
+			th, err := seizeThread(tid)
+			if err == syscall.ESRCH {
+				continue
+			}
+			if err != nil {
+				t.Detach()
+				return nil, fmt.Errorf("thread %d: %v", tid, err)
+			}
+			if th != nil {
+				t.Threads = append(t.Threads, th)
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	if len(t.Threads) == 0 {
+		t.Detach()
+		return nil, fmt.Errorf("no threads of %d seized", pid)
+	}
+
+	sort.Slice(t.Threads, func(i, j int) bool {
+		// the main thread goes first as the kernel does
+		if (t.Threads[i].Tid == pid) != (t.Threads[j].Tid == pid) {
+			return t.Threads[i].Tid == pid
+		}
+		return t.Threads[i].Tid < t.Threads[j].Tid
+	})
+
+	for _, th := range t.Threads {
+		if _, err := getRegSet(th.Tid, NT_PRSTATUS, unsafe.Pointer(&th.Regs), int(unsafe.Sizeof(th.Regs))); err != nil {
+			t.Detach()
+			return nil, fmt.Errorf("thread %d registers: %v", th.Tid, err)
+		}
+		fp := make([]byte, 4096)
+		if n, err := getRegSet(th.Tid, NT_PRFPREG, unsafe.Pointer(&fp[0]), len(fp)); err == nil {
+			th.FPRegs = fp[:n]
+		}
+	}
+
+	return t, nil
+}
+
+// seizeThread returns nil if the thread exited before it stopped.
+func seizeThread(tid int) (*TraceeThread, error) {
+	if err := ptrace(_PTRACE_SEIZE, tid, 0, 0); err != nil {
+		return nil, err
+	}
+	if err := ptrace(_PTRACE_INTERRUPT, tid, 0, 0); err != nil {
+		return nil, err
+	}
+
+	th := &TraceeThread{Tid: tid}
+	for {
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &ws, syscall.WALL, nil); err != nil {
+			return nil, err
+		}
+		switch {
+		case ws.Exited() || ws.Signaled():
+			return nil, nil
+		case ws.Stopped() && int(ws>>16) == _PTRACE_EVENT_STOP:
+			return th, nil
+		case ws.Stopped():
+			// a signal arrived first, it is delivered back on detach
+			th.sig = ws.StopSignal()
+			return th, nil
+		}
+	}
+}
+
+// Detach resumes the threads and unlocks the goroutine from its thread.
+func (t *Tracee) Detach() error {
+	defer runtime.UnlockOSThread()
+
+	var first error
+	for _, th := range t.Threads {
+		if err := ptrace(syscall.PTRACE_DETACH, th.Tid, 0, uintptr(th.sig)); err != nil && first == nil {
+			first = fmt.Errorf("detach %d: %v", th.Tid, err)
+		}
+	}
+	t.Threads = nil
+	return first
+}
+
+// getRegSet returns the size of the register set the kernel filled in.
+func getRegSet(tid int, typ NoteType, p unsafe.Pointer, size int) (int, error) {
+	iov := syscall.Iovec{Base: (*byte)(p)}
+	iov.SetLen(size)
+	err := ptrace(_PTRACE_GETREGSET, tid, uintptr(typ), uintptr(unsafe.Pointer(&iov)))
+	return int(iov.Len), err
+}
+
+func ptrace(req, tid int, addr, data uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(req), uintptr(tid), addr, data, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func procTasks(pid int) ([]int, error) {
+	fs, err := ioutil.ReadDir(procPath(pid, "task"))
+	if err != nil {
+		return nil, err
+	}
+	var tids []int
+	for _, f := range fs {
+		if tid, err := strconv.Atoi(f.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package elf
+
+import "errors"
+
+// TraceeThread is a thread of a stopped process.
+type TraceeThread struct {
+	Tid    int
+	Regs   ElfGRegSet
+	FPRegs []byte
+}
+
+// Tracee is a process with all of its threads stopped by ptrace.
+type Tracee struct {
+	Pid     int
+	Threads []*TraceeThread
+}
+
+// SeizeProcess is only supported on Linux.
+func SeizeProcess(pid int) (*Tracee, error) {
+	return nil, errors.New("ptrace is only supported on linux")
+}
+
+func (t *Tracee) Detach() error { return nil }
@@ -0,0 +1,323 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+// AddrRange is the [Start, End) range of addresses.
+type AddrRange struct {
+	Start, End uint64
+}
+
+// AddrRanges is a set of address ranges, sorted and merged by Merge.
+type AddrRanges []AddrRange
+
+func (rs AddrRanges) Add(start, end uint64) AddrRanges {
+	if start >= end {
+		return rs
+	}
+	return append(rs, AddrRange{start, end})
+}
+
+// Merge sorts the ranges and joins the overlapping and adjacent ones.
+func (rs AddrRanges) Merge() AddrRanges {
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Start < rs[j].Start })
+	var out AddrRanges
+	for _, r := range rs {
+		if n := len(out); n > 0 && r.Start <= out[n-1].End {
+			if r.End > out[n-1].End {
+				out[n-1].End = r.End
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Size is the number of addresses in the merged ranges.
+func (rs AddrRanges) Size() uint64 {
+	var n uint64
+	for _, r := range rs {
+		n += r.End - r.Start
+	}
+	return n
+}
+
+// Overlaps reports whether the merged ranges intersect [start, end).
+func (rs AddrRanges) Overlaps(start, end uint64) bool {
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].End > start })
+	return i < len(rs) && rs[i].Start < end
+}
+
+// Intersect returns the parts of the merged ranges inside of the merged
+// ranges of o.
+func (rs AddrRanges) Intersect(o AddrRanges) AddrRanges {
+	var out AddrRanges
+	for i, j := 0, 0; i < len(rs) && j < len(o); {
+		start, end := rs[i].Start, rs[i].End
+		if o[j].Start > start {
+			start = o[j].Start
+		}
+		if o[j].End < end {
+			end = o[j].End
+		}
+		out = out.Add(start, end)
+		if rs[i].End < o[j].End {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out
+}
+
+// RedactedReader reads R and zeroes the bytes outside of Keep and inside
+// of Scrub. Both sets must be merged.
+type RedactedReader struct {
+	R     io.ReaderAt
+	Keep  AddrRanges
+	Scrub AddrRanges
+}
+
+func (r *RedactedReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.R.ReadAt(p, off)
+	a, end := uint64(off), uint64(off)+uint64(n)
+
+	// the gaps between the kept ranges
+	i := sort.Search(len(r.Keep), func(i int) bool { return r.Keep[i].End > a })
+	for from := a; from < end; i++ {
+		to := end
+		if i < len(r.Keep) && r.Keep[i].Start < end {
+			to = r.Keep[i].Start
+		}
+		zeroRange(p, a, from, to)
+		if i >= len(r.Keep) || r.Keep[i].End >= end {
+			break
+		}
+		from = r.Keep[i].End
+	}
+
+	i = sort.Search(len(r.Scrub), func(i int) bool { return r.Scrub[i].End > a })
+	for ; i < len(r.Scrub) && r.Scrub[i].Start < end; i++ {
+		zeroRange(p, a, r.Scrub[i].Start, r.Scrub[i].End)
+	}
+
+	return n, err
+}
+
+// zeroRange zeroes [from, to) of p read at addr.
+func zeroRange(p []byte, addr, from, to uint64) {
+	if from < addr {
+		from = addr
+	}
+	if end := addr + uint64(len(p)); to > end {
+		to = end
+	}
+	for a := from; a < to; a++ {
+		p[a-addr] = 0
+	}
+}
+
+// GoroutineStacks returns the stacks of all goroutines, including g0 and
+// signal stacks of the threads.
+func GoroutineStacks(r *MemReader, d *dwarf.Data) (AddrRanges, error) {
+	var rs AddrRanges
+	stack := func(gp Value) {
+		if gp.Type == nil {
+			return
+		}
+		rs = rs.Add(uintPath(gp, "stack", "lo"), uintPath(gp, "stack", "hi"))
+	}
+
+	allgs, err := GlobalValue(r, d, "runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	n, _ := allgs.Len()
+	for i := uint64(0); i < n && i < maxAll; i++ {
+		gp, err := allgs.Index(i)
+		if err != nil {
+			break
+		}
+		if gp, err = gp.Elem(); err == nil {
+			stack(gp)
+		}
+	}
+
+	for _, m := range allMs(r, d) {
+		for _, name := range []string{"g0", "gsignal"} {
+			if gp, err := m.Field(name); err == nil {
+				stack(gp)
+			}
+		}
+	}
+
+	return rs.Merge(), nil
+}
+
+// RuntimeRanges returns the memory the debuggers need to list goroutines
+// and threads: the scheduler globals, the g and m structures.
+func RuntimeRanges(r *MemReader, d *dwarf.Data) (AddrRanges, error) {
+	var rs AddrRanges
+	add := func(v Value) {
+		if v.Type != nil && v.Type.Size() > 0 {
+			rs = rs.Add(v.Addr, v.Addr+uint64(v.Type.Size()))
+		}
+	}
+
+	for _, name := range []string{"runtime.allgs", "runtime.allglen", "runtime.allm", "runtime.m0", "runtime.g0", "runtime.sched", "runtime.memstats", "runtime.gcController", "runtime.allp", "runtime.gomaxprocs", "runtime.firstmoduledata", "runtime.buildVersion"} {
+		if v, err := GlobalValue(r, d, name); err == nil {
+			add(v)
+		}
+	}
+
+	allgs, err := GlobalValue(r, d, "runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	n, _ := allgs.Len()
+	if first, err := allgs.Index(0); err == nil && n > 0 {
+		// the backing array of the slice
+		rs = rs.Add(first.Addr, first.Addr+n*uint64(first.Type.Size()))
+	}
+	for i := uint64(0); i < n && i < maxAll; i++ {
+		gp, err := allgs.Index(i)
+		if err != nil {
+			break
+		}
+		if gp, err = gp.Elem(); err == nil {
+			add(gp)
+		}
+	}
+
+	for _, m := range allMs(r, d) {
+		add(m)
+	}
+
+	return rs.Merge(), nil
+}
+
+// allMs returns the m structures of runtime.allm.
+func allMs(r *MemReader, d *dwarf.Data) []Value {
+	v, err := GlobalValue(r, d, "runtime.allm")
+	if err != nil {
+		return nil
+	}
+	var ms []Value
+	for m, err := v.Elem(); err == nil && len(ms) < maxAll; m, err = m.Elem() {
+		ms = append(ms, m)
+		if m, err = m.Field("alllink"); err != nil {
+			break
+		}
+	}
+	return ms
+}
+
+// InitialStack is the part of the main thread stack prepared by the
+// kernel: argc, the argv and envp vectors, the auxiliary vector and the
+// strings they point to.
+type InitialStack struct {
+	// Start is the address of argc, End is the end of the stack mapping.
+	Start, End uint64
+	// Args are the argument strings but the first, Env are the
+	// environment strings. The terminating zeros are not included.
+	Args, Env AddrRanges
+}
+
+// FindInitialStack looks for the auxiliary vector on the stack the
+// AT_EXECFN string is on and walks back the envp and argv vectors
+// preceding it.
+func FindInitialStack(mem Memory, auxvData []byte, o binary.ByteOrder, c elf.Class) (*InitialStack, error) {
+	auxv, err := ParseAuxv(auxvData, o, c)
+	if err != nil {
+		return nil, err
+	}
+	var execfn uint64
+	for _, a := range auxv {
+		if a.Tag == AT_EXECFN {
+			execfn = a.Val
+		}
+	}
+	m := FindMapping(mem, execfn)
+	if execfn == 0 || m == nil {
+		return nil, fmt.Errorf("stack of AT_EXECFN 0x%x is not found", execfn)
+	}
+	buf := make([]byte, m.Size())
+	n, _ := mem.ReadAt(buf, int64(m.Start))
+	buf = buf[:n]
+
+	ptr := 8
+	if c == elf.ELFCLASS32 {
+		ptr = 4
+	}
+	word := func(i int) uint64 {
+		if ptr == 4 {
+			return uint64(o.Uint32(buf[i*ptr:]))
+		}
+		return o.Uint64(buf[i*ptr:])
+	}
+
+	// the copy of the kernel is the same as the vector on the stack
+	pos := -1
+	for from := 0; from < len(buf); {
+		k := bytes.Index(buf[from:], auxvData)
+		if k < 0 {
+			break
+		}
+		if (from+k)%ptr == 0 {
+			pos = from + k
+			break
+		}
+		from += k + 1
+	}
+	if pos < 0 {
+		return nil, fmt.Errorf("auxiliary vector is not found on the stack at 0x%x", m.Start)
+	}
+
+	// envp and argv are terminated by NULL, argv is preceded by argc
+	i := pos/ptr - 1
+	if i < 0 || word(i) != 0 {
+		return nil, fmt.Errorf("no envp terminator before the auxiliary vector at 0x%x", m.Start+uint64(pos))
+	}
+	var env, args []uint64
+	for i--; i >= 0 && word(i) != 0; i-- {
+		env = append(env, word(i))
+	}
+	for i--; i >= 0 && word(i) != uint64(len(args)); i-- {
+		args = append(args, word(i))
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("argc is not found before the argument vector")
+	}
+
+	s := &InitialStack{Start: m.Start + uint64(i*ptr), End: m.End}
+	str := func(rs AddrRanges, addr uint64) AddrRanges {
+		if !m.Contains(addr) || addr-m.Start >= uint64(len(buf)) {
+			return rs
+		}
+		off := addr - m.Start
+		k := bytes.IndexByte(buf[off:], 0)
+		if k < 0 {
+			k = len(buf) - int(off)
+		}
+		return rs.Add(addr, addr+uint64(k))
+	}
+	for _, a := range env {
+		s.Env = str(s.Env, a)
+	}
+	// args are collected backwards, argv[0] is the last one
+	for k := 0; k+1 < len(args); k++ {
+		s.Args = str(s.Args, args[k])
+	}
+	s.Env, s.Args = s.Env.Merge(), s.Args.Merge()
+
+	return s, nil
+}
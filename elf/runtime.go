@@ -0,0 +1,172 @@
+package elf
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/dwarf"
+)
+
+const pageSize = 8192
+
+// Goroutine states of runtime.g.atomicstatus.
+var GoroutineStatus = []string{
+	"idle", "runnable", "running", "syscall", "waiting", "moribund", "dead", "enqueue", "copystack", "preempted",
+}
+
+const (
+	gDead  = 6
+	gScan  = 0x1000
+	maxAll = 1 << 20
+)
+
+// RuntimeStats is the summary of the runtime globals of a process. The
+// fields are 0 when the runtime version does not have them.
+type RuntimeStats struct {
+	HeapInUse    uint64
+	HeapLive     uint64
+	HeapGoal     uint64
+	HeapMarked   uint64
+	HeapReleased uint64
+	TotalAlloc   uint64
+	StacksInUse  uint64
+	GCPercent    int64
+	MemoryLimit  int64
+
+	NumGC       uint64
+	NumForcedGC uint64
+	PauseTotal  uint64
+	// LastGC is the end of the last GC in nanoseconds since the epoch.
+	LastGC uint64
+
+	GOMAXPROCS int64
+	IdlePs     int64
+	SpinningMs int64
+	IdleMs     int64
+	RunQueue   int64
+
+	Ms int
+	Ps int
+	Gs int
+	// Goroutines counts allgs by GoroutineStatus.
+	Goroutines map[string]int
+}
+
+// ReadRuntimeStats decodes runtime.memstats, mheap_, gcController, sched
+// and the lists of Ms, Ps and Gs.
+func ReadRuntimeStats(r *MemReader, d *dwarf.Data) (*RuntimeStats, error) {
+	global := func(name string) Value {
+		v, _ := GlobalValue(r, d, name)
+		return v
+	}
+	memstats, heap := global("runtime.memstats"), global("runtime.mheap_")
+	gcc, sched := global("runtime.gcController"), global("runtime.sched")
+	if memstats.Type == nil || heap.Type == nil {
+		return nil, fmt.Errorf("no runtime.memstats or runtime.mheap_ in DWARF")
+	}
+
+	s := &RuntimeStats{Goroutines: map[string]int{}}
+
+	// the fields moved from memstats to gcController in Go 1.18-1.21
+	s.HeapInUse = uintPath(gcc, "heapInUse") + uintPath(memstats, "heap_inuse")
+	if s.HeapInUse == 0 {
+		s.HeapInUse = uintPath(heap, "pagesInUse") * pageSize
+	}
+	s.HeapLive = uintPath(gcc, "heapLive") + uintPath(memstats, "heap_live")
+	s.HeapGoal = uintPath(gcc, "gcPercentHeapGoal") + uintPath(memstats, "next_gc")
+	s.HeapMarked = uintPath(gcc, "heapMarked") + uintPath(memstats, "heap_marked")
+	s.HeapReleased = uintPath(gcc, "heapReleased") + uintPath(memstats, "heap_released")
+	s.TotalAlloc = uintPath(gcc, "totalAlloc") + uintPath(memstats, "total_alloc")
+	s.GCPercent = intPath(gcc, "gcPercent")
+	s.MemoryLimit = intPath(gcc, "memoryLimit")
+
+	s.StacksInUse = uintPath(memstats, "stacks_inuse")
+	if st, err := memstats.Path("heapStats", "stats"); err == nil {
+		// consistentHeapStats is the sum of its generations
+		n, _ := st.Len()
+		for i := uint64(0); i < n; i++ {
+			if g, err := st.Index(i); err == nil {
+				s.StacksInUse += uintPath(g, "inStacks")
+			}
+		}
+	}
+
+	s.NumGC = uintPath(memstats, "numgc")
+	s.NumForcedGC = uintPath(memstats, "numforcedgc")
+	s.PauseTotal = uintPath(memstats, "pause_total_ns")
+	s.LastGC = uintPath(memstats, "last_gc_unix")
+
+	if v := global("runtime.gomaxprocs"); v.Type != nil {
+		s.GOMAXPROCS, _ = v.Int()
+	}
+	s.IdlePs = intPath(sched, "npidle")
+	s.SpinningMs = intPath(sched, "nmspinning")
+	s.IdleMs = intPath(sched, "nmidle")
+	s.RunQueue = intPath(sched, "runq", "size") + intPath(sched, "runqsize")
+
+	if v := global("runtime.allp"); v.Type != nil {
+		n, _ := v.Len()
+		s.Ps = int(n)
+	}
+
+	if v := global("runtime.allm"); v.Type != nil {
+		for m, err := v.Elem(); err == nil && s.Ms < maxAll; m, err = m.Elem() {
+			s.Ms++
+			if m, err = m.Field("alllink"); err != nil {
+				break
+			}
+		}
+	}
+
+	if v := global("runtime.allgs"); v.Type != nil {
+		n, _ := v.Len()
+		for i := uint64(0); i < n && i < maxAll; i++ {
+			gp, err := v.Index(i)
+			if err != nil {
+				break
+			}
+			s.Gs++
+			st, err := gp.Field("atomicstatus")
+			if err != nil {
+				continue
+			}
+			status, _ := st.Uint()
+			status &^= gScan
+			if status < uint64(len(GoroutineStatus)) {
+				s.Goroutines[GoroutineStatus[status]]++
+			} else {
+				s.Goroutines[fmt.Sprintf("status %d", status)]++
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Live returns the number of goroutines that are not dead.
+func (s *RuntimeStats) Live() int {
+	return s.Gs - s.Goroutines[GoroutineStatus[gDead]]
+}
+
+func uintPath(v Value, names ...string) uint64 {
+	if v.Type == nil {
+		return 0
+	}
+	f, err := v.Path(names...)
+	if err != nil {
+		return 0
+	}
+	u, _ := f.Uint()
+	return u
+}
+
+func intPath(v Value, names ...string) int64 {
+	if v.Type == nil {
+		return 0
+	}
+	f, err := v.Path(names...)
+	if err != nil {
+		return 0
+	}
+	i, _ := f.Int()
+	return i
+}
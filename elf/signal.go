@@ -0,0 +1,57 @@
+package elf
+
+import "fmt"
+
+// Signal is a Linux signal number.
+type Signal int32
+
+var signalStrings = []intName{
+	{1, "SIGHUP"},
+	{2, "SIGINT"},
+	{3, "SIGQUIT"},
+	{4, "SIGILL"},
+	{5, "SIGTRAP"},
+	{6, "SIGABRT"},
+	{7, "SIGBUS"},
+	{8, "SIGFPE"},
+	{9, "SIGKILL"},
+	{10, "SIGUSR1"},
+	{11, "SIGSEGV"},
+	{12, "SIGUSR2"},
+	{13, "SIGPIPE"},
+	{14, "SIGALRM"},
+	{15, "SIGTERM"},
+	{16, "SIGSTKFLT"},
+	{17, "SIGCHLD"},
+	{18, "SIGCONT"},
+	{19, "SIGSTOP"},
+	{20, "SIGTSTP"},
+	{21, "SIGTTIN"},
+	{22, "SIGTTOU"},
+	{23, "SIGURG"},
+	{24, "SIGXCPU"},
+	{25, "SIGXFSZ"},
+	{26, "SIGVTALRM"},
+	{27, "SIGPROF"},
+	{28, "SIGWINCH"},
+	{29, "SIGIO"},
+	{30, "SIGPWR"},
+	{31, "SIGSYS"},
+}
+
+func (s Signal) String() string {
+	if s > 0 && int(s) <= len(signalStrings) {
+		return signalStrings[s-1].s
+	}
+	return fmt.Sprintf("signal %d", int32(s))
+}
+
+// Fault tells whether the signal is raised by an instruction, so siginfo
+// has the faulting address.
+func (s Signal) Fault() bool {
+	switch s {
+	case 4, 5, 7, 8, 11: // SIGILL, SIGTRAP, SIGBUS, SIGFPE, SIGSEGV
+		return true
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/debug/elf"
+)
+
+// maxFrames limits unwinding of corrupted stacks.
+const maxFrames = 1024
+
+// Frame is a function call on a stack.
+type Frame struct {
+	PC uint64
+	SP uint64
+	// Call is set if PC is a return address, so the call instruction is
+	// at PC-1. It is not for the innermost frame and the frames
+	// interrupted by a signal.
+	Call bool
+
+	Func  string
+	Entry uint64
+	// Inlined is set if the call of Func is inlined into the function of
+	// the next frame, both are in the same physical frame.
+	Inlined bool
+	// Args are the arguments formatted like the runtime tracebacks do,
+	// empty if unknown.
+	Args string
+}
+
+// LookupPC returns the address to symbolize the frame by.
+func (f Frame) LookupPC() uint64 {
+	if f.Call && f.PC > 0 {
+		return f.PC - 1
+	}
+	return f.PC
+}
+
+// sigtramp is the signal handler entry. On amd64 the kernel signal frame
+// (rt_sigframe) follows its return address: a ucontext with the registers
+// of the interrupted code, RSP and RIP at these offsets.
+const (
+	sigtramp    = "runtime.sigtramp"
+	ucontextRSP = 40 + 15*8
+	ucontextRIP = 40 + 16*8
+)
+
+// stackTops are the functions stacks start with or switch stacks at.
+var stackTops = map[string]bool{
+	"runtime.goexit":      true,
+	"runtime.mstart":      true,
+	"runtime.mstart0":     true,
+	"runtime.rt0_go":      true,
+	"runtime.mcall":       true,
+	"runtime.morestack":   true,
+	"runtime.systemstack": true,
+	"runtime.asmcgocall":  true,
+}
+
+// Unwinder walks Go stacks by the frame sizes of pclntab. Only machines
+// which push the return address on the stack (x86) are supported.
+type Unwinder struct {
+	R   *MemReader
+	Tab *FuncTab
+}
+
+func NewUnwinder(r *MemReader, tab *FuncTab, m elf.Machine) (*Unwinder, error) {
+	if m != elf.EM_X86_64 && m != elf.EM_386 {
+		return nil, errors.New("stacks can be unwound on x86 only")
+	}
+	return &Unwinder{R: r, Tab: tab}, nil
+}
+
+// Unwind returns the frames of the stack starting at pc and sp up to the
+// top of the stack or the switch to another one. Signal handlers are
+// followed to the interrupted code on amd64. It stops at the first
+// unknown function, the error tells why the stack is incomplete.
+func (u *Unwinder) Unwind(pc, sp uint64) ([]Frame, error) {
+	var frames []Frame
+	call := false
+	for len(frames) < maxFrames {
+		f, ok := u.Tab.FuncForPC(pc)
+		if !ok {
+			frames = append(frames, Frame{PC: pc, SP: sp, Call: call})
+			return frames, errors.New("unknown function")
+		}
+		fr := Frame{PC: pc, SP: sp, Call: call, Func: f.Name, Entry: f.Entry}
+		delta, ok := u.Tab.SPDelta(f, pc)
+		fp := sp + uint64(delta) + uint64(u.R.PtrSize)
+		if ok && delta >= 0 {
+			// the arguments are above the return address
+			fr.Args = u.args(f, fr, fp)
+		}
+		frames = append(frames, u.inlined(f, fr)...)
+		if stackTops[f.Name] {
+			return frames, nil
+		}
+		if !ok || delta < 0 {
+			return frames, errors.New("no frame size")
+		}
+		if f.Name == sigtramp {
+			if u.R.PtrSize != 8 {
+				return frames, nil
+			}
+			var err error
+			if pc, err = u.R.Ptr(fp + ucontextRIP); err == nil {
+				sp, err = u.R.Ptr(fp + ucontextRSP)
+			}
+			if err != nil {
+				return frames, err
+			}
+			call = false
+			continue
+		}
+		ret, err := u.R.Ptr(fp - uint64(u.R.PtrSize))
+		if err != nil {
+			return frames, err
+		}
+		if ret == 0 {
+			return frames, nil
+		}
+
+		// the signal handler pretends the faulting instruction called it
+		call = f.Name != "runtime.sigpanic"
+		pc, sp = ret, fp
+	}
+	return frames, errors.New("too many frames")
+}
+
+// inlined expands the physical frame fr of f into the calls inlined at
+// its pc, innermost first, followed by the frame of f itself at the call
+// site of the outermost inlined call.
+func (u *Unwinder) inlined(f *Func, fr Frame) []Frame {
+	var frames []Frame
+	pc := fr.LookupPC()
+	for len(frames) < maxFrames {
+		c, ok := u.Tab.InlinedAt(u.R, f, pc)
+		if !ok {
+			break
+		}
+		inl := fr
+		inl.Func, inl.Inlined = c.Name, true
+		if fr.Args != "" {
+			inl.Args = "..."
+		}
+		frames = append(frames, inl)
+		// the callers are at the calls, not the return addresses
+		pc = f.Entry + c.ParentPC
+		fr.PC, fr.Call = pc, false
+	}
+	return append(frames, fr)
+}
+
+// the operations of FUNCDATA_ArgInfo, the other bytes are pairs of the
+// offset and the size of an argument word
+const (
+	argEndSeq         = 0xff
+	argStartAgg       = 0xfe
+	argEndAgg         = 0xfd
+	argDotdotdot      = 0xfc
+	argOffsetTooLarge = 0xfb
+)
+
+// maxArgInfo bounds FUNCDATA_ArgInfo, the runtime limits it to 10 words
+// in up to 5 levels of aggregates.
+const maxArgInfo = 256
+
+// args formats the argument area at argp by FUNCDATA_ArgInfo (Go 1.17+)
+// like printArgs of the runtime: the words of the arguments, {} for
+// aggregates, ... for the rest and ? after the values the liveness info
+// says may be dead. Register arguments are in the area only if spilled,
+// so the values may be stale.
+func (u *Unwinder) args(f *Func, fr Frame, argp uint64) string {
+	info, ok := u.Tab.funcdata(f, funcdataArgInfo)
+	if !ok {
+		return ""
+	}
+	liveInfo, hasLive := u.Tab.funcdata(f, funcdataArgLiveInfo)
+	liveIdx, startOffset := int64(-1), uint8(argEndSeq)
+	if hasLive {
+		if i, ok := u.Tab.pcValue(u.Tab.pcdata(f, pcdataArgLiveIndex), f.Entry, fr.LookupPC()); ok {
+			liveIdx = i
+		}
+		if off, err := u.R.Uint8(liveInfo); err == nil {
+			startOffset = off
+		}
+	}
+	live := func(off, slot uint8) bool {
+		if !hasLive || liveIdx <= 0 || off < startOffset {
+			return true
+		}
+		bits, err := u.R.Uint8(liveInfo + uint64(liveIdx) + uint64(slot/8))
+		return err != nil || bits&(1<<(slot%8)) != 0
+	}
+
+	var b strings.Builder
+	start := true
+	comma := func() {
+		if !start {
+			b.WriteString(", ")
+		}
+	}
+	var slot uint8
+	for i := uint64(0); i < maxArgInfo; i++ {
+		op, err := u.R.Uint8(info + i)
+		if err != nil {
+			break
+		}
+		switch op {
+		case argEndSeq:
+			return b.String()
+		case argStartAgg:
+			comma()
+			b.WriteString("{")
+			start = true
+			continue
+		case argEndAgg:
+			b.WriteString("}")
+		case argDotdotdot:
+			comma()
+			b.WriteString("...")
+		case argOffsetTooLarge:
+			comma()
+			b.WriteString("_")
+		default:
+			comma()
+			i++
+			size, err := u.R.Uint8(info + i)
+			if err != nil {
+				return b.String()
+			}
+			b.WriteString(u.argWord(argp+uint64(op), size))
+			if !live(op, slot) {
+				b.WriteString("?")
+			}
+			if op >= startOffset {
+				slot++
+			}
+		}
+		start = false
+	}
+	return b.String()
+}
+
+// argWord formats the argument word of size bytes at addr.
+func (u *Unwinder) argWord(addr uint64, size uint8) string {
+	var x uint64
+	var err error
+	switch size {
+	case 1:
+		var v uint8
+		v, err = u.R.Uint8(addr)
+		x = uint64(v)
+	case 2:
+		var v uint16
+		v, err = u.R.Uint16(addr)
+		x = uint64(v)
+	case 4:
+		var v uint32
+		v, err = u.R.Uint32(addr)
+		x = uint64(v)
+	default:
+		x, err = u.R.Uint64(addr)
+	}
+	if err != nil {
+		return "_"
+	}
+	return fmt.Sprintf("0x%x", x)
+}
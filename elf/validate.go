@@ -0,0 +1,324 @@
+package elf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/debug/elf"
+)
+
+// CheckStatus is the outcome of a check of a core against an executable.
+type CheckStatus int
+
+const (
+	CheckOK CheckStatus = iota
+	// CheckUnknown means the core has not enough data to tell.
+	CheckUnknown
+	CheckMismatch
+)
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckOK:
+		return "ok"
+	case CheckUnknown:
+		return "unknown"
+	case CheckMismatch:
+		return "MISMATCH"
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
+// CoreCheck compares a property of the executable to the one seen in the
+// core.
+type CoreCheck struct {
+	Name   string
+	Status CheckStatus
+	Exe    string
+	Core   string
+}
+
+// Mismatch reports whether any of the checks failed.
+func Mismatch(checks []CoreCheck) bool {
+	for _, c := range checks {
+		if c.Status == CheckMismatch {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCore checks the core was dumped by a process running exe found
+// at path: the auxiliary vector entry and program headers, the layout of
+// the PT_LOAD segments, the file mapped at the load address (NT_FILE)
+// and the build IDs read from the dumped ELF headers of the executable.
+func ValidateCore(exe, core *elf.File, path string) []CoreCheck {
+	var checks []CoreCheck
+	check := func(name string, ok bool, exeValue, coreValue string) {
+		s := CheckOK
+		if !ok {
+			s = CheckMismatch
+		}
+		checks = append(checks, CoreCheck{name, s, exeValue, coreValue})
+	}
+	unknown := func(name, exeValue, reason string) {
+		checks = append(checks, CoreCheck{name, CheckUnknown, exeValue, reason})
+	}
+
+	if exe.Class != core.Class || exe.Machine != core.Machine || exe.ByteOrder != core.ByteOrder {
+		check("machine", false, fmt.Sprintf("%v %v %v", exe.Machine, exe.Class, exe.ByteOrder), fmt.Sprintf("%v %v %v", core.Machine, core.Class, core.ByteOrder))
+		return checks
+	}
+	check("machine", true, fmt.Sprintf("%v %v", exe.Machine, exe.Class), fmt.Sprintf("%v %v", core.Machine, core.Class))
+
+	auxv := map[AuxvTag]uint64{}
+	if vs, err := CoreAuxv(core); err == nil {
+		for _, a := range vs {
+			auxv[a.Tag] = a.Val
+		}
+	}
+	pageSize := auxv[AT_PAGESZ]
+	if pageSize == 0 || pageSize&(pageSize-1) != 0 {
+		pageSize = 4096
+	}
+
+	// the load bias of position independent executables is found by the
+	// program headers as the kernel tells where they are
+	var bias uint64
+	phdr, hasPhdr := programHeadersAddr(exe)
+	atPhdr, ok := auxv[AT_PHDR]
+	switch {
+	case !ok || !hasPhdr:
+		unknown("AT_PHDR", hexAddr(phdr), "no AT_PHDR or program headers are not loaded")
+	case exe.Type == elf.ET_DYN:
+		bias = atPhdr - phdr
+		check("AT_PHDR", bias%pageSize == 0, hexAddr(phdr)+" + bias", fmt.Sprintf("%s (bias %s)", hexAddr(atPhdr), hexAddr(bias)))
+	default:
+		check("AT_PHDR", atPhdr == phdr, hexAddr(phdr), hexAddr(atPhdr))
+	}
+	if entry, ok := auxv[AT_ENTRY]; ok {
+		check("AT_ENTRY", entry == exe.Entry+bias, hexAddr(exe.Entry+bias), hexAddr(entry))
+	} else {
+		unknown("AT_ENTRY", hexAddr(exe.Entry+bias), "no AT_ENTRY")
+	}
+
+	coreMem := NewProgMemory(core)
+	var base uint64
+	hasBase := false
+	var prev *elf.Prog
+	for _, p := range exe.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+		start := (p.Vaddr + bias) &^ (pageSize - 1)
+		if !hasBase && p.Off == 0 {
+			base, hasBase = start, true
+		}
+		name := fmt.Sprintf("PT_LOAD %s", hexAddr(start))
+		m := FindMapping(coreMem, start)
+		if m == nil {
+			check(name, false, p.Flags.String(), "not mapped")
+			continue
+		}
+		// the permissions may be changed at run time only if it is writable
+		// (e.g. .data.rel.ro after relocation)
+		flags := p.Flags&^elf.PF_W == m.Flags&^elf.PF_W
+		// the kernel merges the mapping with the tail of the previous
+		// segment if they have the same permissions
+		merged := prev != nil && prev.Flags == m.Flags &&
+			m.Start >= (prev.Vaddr+bias)&^(pageSize-1) && m.Start < start
+		check(name, (m.Start == start || merged) && flags, p.Flags.String(), fmt.Sprintf("%s %v", hexAddr(m.Start), m.Flags))
+		prev = p
+	}
+
+	checks = append(checks, checkMappedFile(core, base, path))
+
+	exeGNU, _ := GNUBuildID(exe)
+	exeGo, _ := GoBuildID(exe)
+	if !hasBase {
+		unknown("GNU build ID", exeGNU, "no executable header segment")
+		return checks
+	}
+	notes, err := MemoryNotes(coreMem, base, core.ByteOrder, core.Class)
+	// not all note sections are in PT_NOTE, e.g. of the Go linker
+	for _, s := range exe.Sections {
+		if s.Type != elf.SHT_NOTE || s.Flags&elf.SHF_ALLOC == 0 || s.Addr == 0 || s.Size > 1<<20 {
+			continue
+		}
+		data := make([]byte, s.Size)
+		if _, err := coreMem.ReadAt(data, int64(s.Addr+bias)); err != nil {
+			continue
+		}
+		if ns, err := readNotes(bytes.NewReader(data), core.ByteOrder); err == nil {
+			notes = append(notes, ns...)
+		}
+	}
+	if len(notes) == 0 && err != nil {
+		unknown("GNU build ID", exeGNU, err.Error())
+		unknown("Go build ID", exeGo, err.Error())
+		return checks
+	}
+	var coreGNU, coreGo string
+	for _, n := range notes {
+		switch {
+		case n.Name == "GNU" && n.Type == NT_GNU_BUILD_ID && coreGNU == "":
+			coreGNU, _ = ReadGNUBuildID(n)
+		case n.Name == "Go" && n.Type == NT_GO_BUILD && coreGo == "":
+			coreGo = string(n.Data)
+		}
+	}
+	for _, id := range []struct{ name, exe, core string }{
+		{"GNU build ID", exeGNU, coreGNU},
+		{"Go build ID", exeGo, coreGo},
+	} {
+		switch {
+		case id.exe == "" && id.core == "":
+			continue
+		case id.core == "":
+			unknown(id.name, id.exe, "no note in the dumped memory")
+		default:
+			check(id.name, id.exe == id.core, id.exe, id.core)
+		}
+	}
+
+	return checks
+}
+
+// checkMappedFile finds the file of the executable at base in NT_FILE.
+// The executable may be renamed or moved, so different names are not a
+// mismatch.
+func checkMappedFile(core *elf.File, base uint64, path string) CoreCheck {
+	c := CoreCheck{Name: "NT_FILE", Status: CheckUnknown, Exe: path, Core: "no NT_FILE"}
+	notes, _ := ReadAllNotes(core)
+	for _, n := range notes {
+		if n.Name != "CORE" || n.Type != NT_FILE {
+			continue
+		}
+		files, err := ReadFileNote(n, core.ByteOrder, core.Class)
+		if err != nil {
+			c.Core = err.Error()
+			return c
+		}
+		c.Core = fmt.Sprintf("nothing at %s", hexAddr(base))
+		for _, f := range files {
+			if f.Start != base {
+				continue
+			}
+			c.Core = f.Name
+			if f.Name == path || filepath.Base(f.Name) == filepath.Base(path) {
+				c.Status = CheckOK
+			} else if a, err := os.Stat(f.Name); err == nil {
+				if b, err := os.Stat(path); err == nil && os.SameFile(a, b) {
+					c.Status = CheckOK
+				}
+			}
+		}
+	}
+	return c
+}
+
+// programHeadersAddr returns the link time address of the program
+// headers if they are loaded.
+func programHeadersAddr(f *elf.File) (uint64, bool) {
+	var phoff uint64
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_PHDR {
+			return p.Vaddr, true
+		}
+	}
+	switch f.Class {
+	case elf.ELFCLASS64:
+		phoff = 64
+	case elf.ELFCLASS32:
+		phoff = 52
+	}
+	// without PT_PHDR they usually follow the ELF header
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && p.Off == 0 && p.Filesz > phoff {
+			return p.Vaddr + phoff, true
+		}
+	}
+	return 0, false
+}
+
+// MemoryNotes reads the notes of the ELF file loaded at base from the
+// memory of a process, i.e. its ELF header and PT_NOTE segments are to be
+// dumped.
+func MemoryNotes(mem Memory, base uint64, o binary.ByteOrder, c elf.Class) ([]*Note, error) {
+	ident := make([]byte, elf.EI_NIDENT)
+	if _, err := mem.ReadAt(ident, int64(base)); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(ident, []byte(elf.ELFMAG)) {
+		return nil, fmt.Errorf("no ELF header at %s", hexAddr(base))
+	}
+
+	var progs []elf.ProgHeader
+	switch c {
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if err := readStruct(mem, base, o, &hdr); err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < uint64(hdr.Phnum); i++ {
+			var p elf.Prog64
+			if err := readStruct(mem, base+hdr.Phoff+i*uint64(hdr.Phentsize), o, &p); err != nil {
+				return nil, err
+			}
+			progs = append(progs, elf.ProgHeader{Type: elf.ProgType(p.Type), Off: p.Off, Vaddr: p.Vaddr, Filesz: p.Filesz})
+		}
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if err := readStruct(mem, base, o, &hdr); err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < uint64(hdr.Phnum); i++ {
+			var p elf.Prog32
+			if err := readStruct(mem, base+uint64(hdr.Phoff)+i*uint64(hdr.Phentsize), o, &p); err != nil {
+				return nil, err
+			}
+			progs = append(progs, elf.ProgHeader{Type: elf.ProgType(p.Type), Off: uint64(p.Off), Vaddr: uint64(p.Vaddr), Filesz: uint64(p.Filesz)})
+		}
+	default:
+		return nil, fmt.Errorf("unknown elf class %v", c)
+	}
+
+	// the header is mapped at base
+	bias := base
+	for _, p := range progs {
+		if p.Type == elf.PT_LOAD && p.Off == 0 {
+			bias = base - p.Vaddr
+			break
+		}
+	}
+
+	var notes []*Note
+	for _, p := range progs {
+		if p.Type != elf.PT_NOTE || p.Filesz == 0 || p.Filesz > 1<<20 {
+			continue
+		}
+		data := make([]byte, p.Filesz)
+		if _, err := mem.ReadAt(data, int64(p.Vaddr+bias)); err != nil {
+			return nil, err
+		}
+		ns, err := readNotes(bytes.NewReader(data), o)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, ns...)
+	}
+	return notes, nil
+}
+
+func readStruct(mem Memory, addr uint64, o binary.ByteOrder, v interface{}) error {
+	data := make([]byte, binary.Size(v))
+	if _, err := mem.ReadAt(data, int64(addr)); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(data), o, v)
+}
+
+func hexAddr(v uint64) string { return fmt.Sprintf("0x%x", v) }
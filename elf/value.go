@@ -0,0 +1,424 @@
+package elf
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// ValuePrinter renders Go values described by DWARF types out of the
+// process memory in the composite literal syntax.
+type ValuePrinter struct {
+	r *MemReader
+
+	// MaxDepth limits the levels of pointers followed.
+	MaxDepth int
+	// MaxLen limits the elements of arrays, slices, maps and channels
+	// and the bytes of strings printed.
+	MaxLen int
+
+	// TypeOf resolves the runtime type descriptor at the address to the
+	// DWARF type to print the dynamic values of interfaces.
+	TypeOf func(addr uint64) (dwarf.Type, error)
+
+	// pointers being expanded on the current path
+	path map[uint64]bool
+}
+
+func NewValuePrinter(r *MemReader) *ValuePrinter {
+	return &ValuePrinter{r: r, MaxDepth: 3, MaxLen: 64}
+}
+
+// Format returns the value of type t located at addr.
+func (vp *ValuePrinter) Format(addr uint64, t dwarf.Type) string {
+	var b strings.Builder
+	vp.path = map[uint64]bool{}
+	vp.value(&b, addr, t, 0, "")
+	return b.String()
+}
+
+func (vp *ValuePrinter) value(b *strings.Builder, addr uint64, t dwarf.Type, depth int, indent string) {
+	switch t := t.(type) {
+	case *dwarf.TypedefType:
+		vp.value(b, addr, t.Type, depth, indent)
+	case *dwarf.QualType:
+		vp.value(b, addr, t.Type, depth, indent)
+	case *dwarf.StringType:
+		vp.str(b, addr)
+	case *dwarf.SliceType:
+		h, err := vp.r.Slice(addr)
+		if err != nil {
+			vp.bad(b, addr, err)
+			return
+		}
+		if h.Data == 0 {
+			fmt.Fprintf(b, "%s(nil)", t)
+			return
+		}
+		fmt.Fprintf(b, "%s len=%d cap=%d ", t, h.Len, h.Cap)
+		vp.elems(b, h.Data, int64(h.Len), t.ElemType, depth, indent)
+	case *dwarf.ArrayType:
+		fmt.Fprintf(b, "%s", t)
+		vp.elems(b, addr, t.Count, t.Type, depth, indent)
+	case *dwarf.StructType:
+		vp.fields(b, addr, t, depth, indent)
+	case *dwarf.PtrType:
+		vp.ptr(b, addr, t, depth, indent)
+	case *dwarf.MapType:
+		vp.mapValue(b, addr, t, depth, indent)
+	case *dwarf.ChanType:
+		vp.chanValue(b, addr, t, depth, indent)
+	case *dwarf.InterfaceType:
+		vp.iface(b, addr, t, depth, indent)
+	case *dwarf.FuncType:
+		p, err := vp.r.Ptr(addr)
+		if err != nil {
+			vp.bad(b, addr, err)
+			return
+		}
+		if p == 0 {
+			fmt.Fprintf(b, "%s(nil)", t)
+			return
+		}
+		fmt.Fprintf(b, "%s(0x%x)", t, p)
+	default:
+		vp.basic(b, addr, t)
+	}
+}
+
+func (vp *ValuePrinter) str(b *strings.Builder, addr uint64) {
+	hdr, err := vp.r.Bytes(addr, 2*vp.r.PtrSize)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+	data, size := vp.r.word(hdr), vp.r.word(hdr[vp.r.PtrSize:])
+	s, err := vp.r.StringAt(data, size, vp.MaxLen)
+	if err != nil {
+		vp.bad(b, data, err)
+		return
+	}
+	fmt.Fprintf(b, "%q", s)
+	if uint64(len(s)) < size {
+		fmt.Fprintf(b, "...(len=%d)", size)
+	}
+}
+
+func (vp *ValuePrinter) elems(b *strings.Builder, addr uint64, n int64, t dwarf.Type, depth int, indent string) {
+	size := uint64(t.Size())
+	var addrs []uint64
+	for i := int64(0); i < n && i < int64(vp.MaxLen); i++ {
+		addrs = append(addrs, addr+uint64(i)*size)
+	}
+	vp.list(b, addrs, n, t, depth, indent)
+}
+
+// list prints the values of type t at addrs out of n elements total.
+func (vp *ValuePrinter) list(b *strings.Builder, addrs []uint64, n int64, t dwarf.Type, depth int, indent string) {
+	inline := isScalar(t)
+
+	b.WriteString("{")
+	for i, a := range addrs {
+		if inline {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+		} else {
+			fmt.Fprintf(b, "\n%s\t", indent)
+		}
+		vp.value(b, a, t, depth, indent+"\t")
+		if !inline {
+			b.WriteString(",")
+		}
+	}
+	vp.more(b, n-int64(len(addrs)), inline, indent)
+	if !inline && n > 0 {
+		fmt.Fprintf(b, "\n%s", indent)
+	}
+	b.WriteString("}")
+}
+
+// more notes the elements left out.
+func (vp *ValuePrinter) more(b *strings.Builder, n int64, inline bool, indent string) {
+	switch {
+	case n <= 0:
+	case inline:
+		fmt.Fprintf(b, ", ...+%d", n)
+	default:
+		fmt.Fprintf(b, "\n%s\t...+%d", indent, n)
+	}
+}
+
+func (vp *ValuePrinter) fields(b *strings.Builder, addr uint64, t *dwarf.StructType, depth int, indent string) {
+	name := t.StructName
+	if name == "" {
+		name = "struct"
+	}
+
+	fmt.Fprintf(b, "%s{", name)
+	for _, f := range t.Field {
+		fmt.Fprintf(b, "\n%s\t%s: ", indent, f.Name)
+		vp.value(b, addr+uint64(f.ByteOffset), f.Type, depth, indent+"\t")
+		b.WriteString(",")
+	}
+	if len(t.Field) > 0 {
+		fmt.Fprintf(b, "\n%s", indent)
+	}
+	b.WriteString("}")
+}
+
+func (vp *ValuePrinter) ptr(b *strings.Builder, addr uint64, t *dwarf.PtrType, depth int, indent string) {
+	p, err := vp.r.Ptr(addr)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+	if p == 0 {
+		b.WriteString("nil")
+		return
+	}
+
+	elem := t.Type
+	if _, ok := elem.(*dwarf.VoidType); ok || elem == nil || depth >= vp.MaxDepth {
+		fmt.Fprintf(b, "(%s)(0x%x)", t, p)
+		return
+	}
+
+	vp.deref(b, p, elem, depth, indent)
+}
+
+// deref prints the value at p pointed to from depth unless the pointer
+// is already being expanded.
+func (vp *ValuePrinter) deref(b *strings.Builder, p uint64, t dwarf.Type, depth int, indent string) {
+	if vp.path[p] {
+		fmt.Fprintf(b, "&(0x%x)<cycle>", p)
+		return
+	}
+	vp.path[p] = true
+	defer delete(vp.path, p)
+
+	fmt.Fprintf(b, "&(0x%x)", p)
+	vp.value(b, p, t, depth+1, indent)
+}
+
+func (vp *ValuePrinter) iface(b *strings.Builder, addr uint64, t *dwarf.InterfaceType, depth int, indent string) {
+	ps := uint64(vp.r.PtrSize)
+	tab, err := vp.r.Ptr(addr)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+	data, err := vp.r.Ptr(addr + ps)
+	if err != nil {
+		vp.bad(b, addr+ps, err)
+		return
+	}
+	if tab == 0 {
+		fmt.Fprintf(b, "%s(nil)", t)
+		return
+	}
+
+	// non-empty interfaces hold an itab{inter, _type, ...}
+	typ := tab
+	if st, ok := under(t.Type).(*dwarf.StructType); !ok || st.StructName != "runtime.eface" {
+		if typ, err = vp.r.Ptr(tab + ps); err != nil {
+			vp.bad(b, tab+ps, err)
+			return
+		}
+	}
+
+	var dt dwarf.Type
+	if vp.TypeOf != nil {
+		dt, err = vp.TypeOf(typ)
+	}
+	if dt == nil || err != nil {
+		fmt.Fprintf(b, "%s(type 0x%x, data 0x%x)", t, typ, data)
+		if err != nil {
+			fmt.Fprintf(b, " <%v>", err)
+		}
+		return
+	}
+
+	fmt.Fprintf(b, "%s(%s) ", t, dt)
+	if isPointerShaped(dt, vp.r.PtrSize) {
+		// the pointer is stored in the data word directly
+		vp.value(b, addr+ps, dt, depth, indent)
+		return
+	}
+	// the value is boxed by the runtime, it is not a pointer of the
+	// program to show
+	vp.value(b, data, dt, depth+1, indent)
+}
+
+func (vp *ValuePrinter) chanValue(b *strings.Builder, addr uint64, t *dwarf.ChanType, depth int, indent string) {
+	c, err := vp.r.Ptr(addr)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+	if c == 0 {
+		fmt.Fprintf(b, "%s(nil)", t)
+		return
+	}
+	fmt.Fprintf(b, "%s(0x%x)", t, c)
+
+	hchan, ok := under(t.Type).(*dwarf.PtrType)
+	if !ok {
+		return
+	}
+	f := func(name string) uint64 {
+		if fl := field(hchan.Type, name); fl != nil {
+			v, _ := vp.r.Uint(c+uint64(fl.ByteOffset), int(fl.Type.Size()))
+			return v
+		}
+		return 0
+	}
+
+	qcount, size, buf, recvx := f("qcount"), f("dataqsiz"), f("buf"), f("recvx")
+	fmt.Fprintf(b, " len=%d cap=%d", qcount, size)
+	if f("closed") != 0 {
+		b.WriteString(" closed")
+	}
+	if qcount == 0 || size == 0 || qcount > size || depth >= vp.MaxDepth {
+		return
+	}
+
+	esize := uint64(t.ElemType.Size())
+	var addrs []uint64
+	for i := uint64(0); i < qcount && i < uint64(vp.MaxLen); i++ {
+		addrs = append(addrs, buf+((recvx+i)%size)*esize)
+	}
+	b.WriteString(" ")
+	vp.list(b, addrs, int64(qcount), t.ElemType, depth+1, indent)
+}
+
+func (vp *ValuePrinter) basic(b *strings.Builder, addr uint64, t dwarf.Type) {
+	size := int(t.Size())
+	if size <= 0 {
+		fmt.Fprintf(b, "%s{}", t)
+		return
+	}
+
+	buf, err := vp.r.Bytes(addr, size)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+
+	u := func(b []byte) uint64 {
+		switch len(b) {
+		case 1:
+			return uint64(b[0])
+		case 2:
+			return uint64(vp.r.Order.Uint16(b))
+		case 4:
+			return uint64(vp.r.Order.Uint32(b))
+		case 8:
+			return vp.r.Order.Uint64(b)
+		}
+		return 0
+	}
+	float := func(b []byte) float64 {
+		if len(b) == 4 {
+			return float64(math.Float32frombits(uint32(u(b))))
+		}
+		return math.Float64frombits(u(b))
+	}
+
+	switch t := t.(type) {
+	case *dwarf.BoolType:
+		fmt.Fprint(b, buf[0] != 0)
+	case *dwarf.IntType, *dwarf.CharType:
+		shift := uint(64 - 8*size)
+		fmt.Fprint(b, int64(u(buf)<<shift)>>shift)
+	case *dwarf.UintType, *dwarf.UcharType:
+		if t.String() == "uintptr" {
+			fmt.Fprintf(b, "0x%x", u(buf))
+		} else {
+			fmt.Fprint(b, u(buf))
+		}
+	case *dwarf.FloatType:
+		fmt.Fprint(b, float(buf))
+	case *dwarf.ComplexType:
+		fmt.Fprint(b, complex(float(buf[:size/2]), float(buf[size/2:])))
+	case *dwarf.EnumType:
+		v := int64(u(buf))
+		for _, e := range t.Val {
+			if e.Val == v {
+				b.WriteString(e.Name)
+				return
+			}
+		}
+		fmt.Fprint(b, v)
+	default:
+		fmt.Fprintf(b, "%s(%x)", t, buf)
+	}
+}
+
+func (vp *ValuePrinter) bad(b *strings.Builder, addr uint64, err error) {
+	fmt.Fprintf(b, "<bad 0x%x: %v>", addr, err)
+}
+
+// under strips typedefs and qualifiers.
+func under(t dwarf.Type) dwarf.Type {
+	for {
+		switch tt := t.(type) {
+		case *dwarf.TypedefType:
+			t = tt.Type
+		case *dwarf.QualType:
+			t = tt.Type
+		default:
+			return t
+		}
+	}
+}
+
+// field returns the struct field of t or of the struct t points to.
+func field(t dwarf.Type, name string) *dwarf.StructField {
+	t = under(t)
+	if p, ok := t.(*dwarf.PtrType); ok {
+		t = under(p.Type)
+	}
+	if st, ok := t.(*dwarf.StructType); ok {
+		for _, f := range st.Field {
+			if f.Name == name {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// isPointerShaped reports whether values of t are stored in the data
+// word of interfaces directly.
+func isPointerShaped(t dwarf.Type, ptrSize int) bool {
+	switch t := under(t).(type) {
+	case *dwarf.PtrType, *dwarf.MapType, *dwarf.ChanType, *dwarf.FuncType:
+		return true
+	case *dwarf.StructType:
+		return len(t.Field) == 1 && t.Size() == int64(ptrSize) && isPointerShaped(t.Field[0].Type, ptrSize)
+	case *dwarf.ArrayType:
+		return t.Count == 1 && isPointerShaped(t.Type, ptrSize)
+	}
+	return false
+}
+
+// isScalar reports whether values of t are printed on a single line.
+func isScalar(t dwarf.Type) bool {
+	for {
+		switch tt := t.(type) {
+		case *dwarf.TypedefType:
+			t = tt.Type
+			continue
+		case *dwarf.StructType, *dwarf.ArrayType, *dwarf.SliceType, *dwarf.PtrType,
+			*dwarf.MapType, *dwarf.ChanType, *dwarf.InterfaceType:
+			return false
+		}
+		return true
+	}
+}
+
+// Reader returns the memory reader of the printer.
+func (vp *ValuePrinter) Reader() *MemReader { return vp.r }
@@ -0,0 +1,281 @@
+package elf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// Map implementations are decoded by the types the linker synthesizes
+// for every map in DWARF: map<K,V>, table<K,V> and groups of slots for
+// Swiss tables (Go 1.24+), hash<K,V> and bucket<K,V> before.
+
+const (
+	// tophash values below mark empty or evacuated bucket cells
+	minTopHash = 5
+	// hmap.flags of the growth to the same number of buckets
+	sameSizeGrow = 8
+	// control bytes of Swiss table slots with the high bit set are
+	// empty or deleted
+	ctrlEmpty  = 0x80
+	groupSlots = 8
+)
+
+func (vp *ValuePrinter) mapValue(b *strings.Builder, addr uint64, t *dwarf.MapType, depth int, indent string) {
+	m, err := vp.r.Ptr(addr)
+	if err != nil {
+		vp.bad(b, addr, err)
+		return
+	}
+	if m == 0 {
+		fmt.Fprintf(b, "%s(nil)", t)
+		return
+	}
+	fmt.Fprintf(b, "%s(0x%x)", t, m)
+
+	hdr, ok := under(t.Type).(*dwarf.PtrType)
+	if !ok {
+		return
+	}
+
+	var keys, elems []uint64
+	var kt, et dwarf.Type
+	var n uint64
+	if field(hdr, "dirPtr") != nil {
+		n, keys, elems, kt, et, err = vp.swissMap(m, hdr.Type)
+	} else {
+		n, keys, elems, kt, et, err = vp.hashMap(m, hdr.Type)
+	}
+	fmt.Fprintf(b, " len=%d", n)
+	if err != nil {
+		fmt.Fprintf(b, " <%v>", err)
+		return
+	}
+	if n == 0 || depth >= vp.MaxDepth {
+		return
+	}
+
+	inline := isScalar(kt) && isScalar(et)
+	b.WriteString(" {")
+	for i := range keys {
+		if inline {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+		} else {
+			fmt.Fprintf(b, "\n%s\t", indent)
+		}
+		vp.value(b, keys[i], kt, depth+1, indent+"\t")
+		b.WriteString(": ")
+		vp.value(b, elems[i], et, depth+1, indent+"\t")
+		if !inline {
+			b.WriteString(",")
+		}
+	}
+	vp.more(b, int64(n)-int64(len(keys)), inline, indent)
+	if !inline {
+		fmt.Fprintf(b, "\n%s", indent)
+	}
+	b.WriteString("}")
+}
+
+// uintField reads the named integer field of the struct of type t at addr.
+func (vp *ValuePrinter) uintField(addr uint64, t dwarf.Type, name string) (uint64, error) {
+	f := field(t, name)
+	if f == nil {
+		return 0, fmt.Errorf("no field %v in %v", name, t)
+	}
+	return vp.r.Uint(addr+uint64(f.ByteOffset), int(f.Type.Size()))
+}
+
+// elemType returns the element type of the array field.
+func elemType(t dwarf.Type, name string) (*dwarf.StructField, dwarf.Type) {
+	f := field(t, name)
+	if f == nil {
+		return nil, nil
+	}
+	if a, ok := under(f.Type).(*dwarf.ArrayType); ok {
+		return f, a.Type
+	}
+	return nil, nil
+}
+
+// pointee returns the type the pointer typed field of t points to.
+func pointee(t dwarf.Type, name string) dwarf.Type {
+	f := field(t, name)
+	if f == nil {
+		return nil
+	}
+	t = under(f.Type)
+	for {
+		p, ok := t.(*dwarf.PtrType)
+		if !ok {
+			return t
+		}
+		t = under(p.Type)
+	}
+}
+
+// swissMap collects at most MaxLen entries of the Swiss table map at m.
+func (vp *ValuePrinter) swissMap(m uint64, mt dwarf.Type) (n uint64, keys, elems []uint64, kt, et dwarf.Type, err error) {
+	if n, err = vp.uintField(m, mt, "used"); err != nil {
+		return
+	}
+	dir, err := vp.uintField(m, mt, "dirPtr")
+	if err != nil {
+		return
+	}
+	dirLen, err := vp.uintField(m, mt, "dirLen")
+	if err != nil {
+		return
+	}
+
+	tt := pointee(mt, "dirPtr")
+	gr := field(tt, "groups")
+	if gr == nil {
+		return n, nil, nil, nil, nil, fmt.Errorf("unexpected table type %v", tt)
+	}
+	gt := pointee(gr.Type, "data")
+	if gt == nil {
+		return n, nil, nil, nil, nil, fmt.Errorf("unexpected groups type %v", gr.Type)
+	}
+	ctrl := field(gt, "ctrl")
+	slots, st := elemType(gt, "slots")
+	if ctrl == nil || slots == nil {
+		return n, nil, nil, nil, nil, fmt.Errorf("unexpected group type %v", gt)
+	}
+	kf, ef := field(st, "key"), field(st, "elem")
+	if kf == nil || ef == nil {
+		return n, nil, nil, nil, nil, fmt.Errorf("unexpected slot type %v", st)
+	}
+	kt, et = kf.Type, ef.Type
+
+	// small maps have a single group instead of the directory
+	groups := []uint64{dir}
+	if dirLen > 0 {
+		groups = nil
+		seen := map[uint64]bool{}
+		for i := uint64(0); i < dirLen && i < 1<<20; i++ {
+			tab, err := vp.r.Ptr(dir + i*uint64(vp.r.PtrSize))
+			if err != nil {
+				return n, keys, elems, kt, et, err
+			}
+			if tab == 0 || seen[tab] {
+				continue
+			}
+			seen[tab] = true
+
+			data, err := vp.uintField(tab+uint64(gr.ByteOffset), gr.Type, "data")
+			if err != nil {
+				return n, keys, elems, kt, et, err
+			}
+			mask, err := vp.uintField(tab+uint64(gr.ByteOffset), gr.Type, "lengthMask")
+			if err != nil {
+				return n, keys, elems, kt, et, err
+			}
+			for g := uint64(0); g <= mask && g < 1<<20; g++ {
+				groups = append(groups, data+g*uint64(gt.Size()))
+			}
+		}
+	}
+
+	for _, g := range groups {
+		cb, err := vp.r.Bytes(g+uint64(ctrl.ByteOffset), groupSlots)
+		if err != nil {
+			return n, keys, elems, kt, et, err
+		}
+		for i := 0; i < groupSlots; i++ {
+			c := cb[i]
+			if vp.r.Order == binary.BigEndian {
+				c = cb[groupSlots-1-i]
+			}
+			if c&ctrlEmpty != 0 {
+				continue
+			}
+			if len(keys) == vp.MaxLen {
+				return n, keys, elems, kt, et, nil
+			}
+			slot := g + uint64(slots.ByteOffset) + uint64(i)*uint64(st.Size())
+			keys = append(keys, slot+uint64(kf.ByteOffset))
+			elems = append(elems, slot+uint64(ef.ByteOffset))
+		}
+	}
+
+	return n, keys, elems, kt, et, nil
+}
+
+// hashMap collects at most MaxLen entries of the bucket hash map at h.
+func (vp *ValuePrinter) hashMap(h uint64, ht dwarf.Type) (n uint64, keys, elems []uint64, kt, et dwarf.Type, err error) {
+	if n, err = vp.uintField(h, ht, "count"); err != nil {
+		return
+	}
+	B, err := vp.uintField(h, ht, "B")
+	if err != nil {
+		return
+	}
+	buckets, err := vp.uintField(h, ht, "buckets")
+	if err != nil {
+		return
+	}
+	old, err := vp.uintField(h, ht, "oldbuckets")
+	if err != nil {
+		return
+	}
+	flags, err := vp.uintField(h, ht, "flags")
+	if err != nil {
+		return
+	}
+
+	bt := pointee(ht, "buckets")
+	top, _ := elemType(bt, "tophash")
+	kf, kt := elemType(bt, "keys")
+	ef, et := elemType(bt, "values")
+	if ef == nil {
+		ef, et = elemType(bt, "elems")
+	}
+	of := field(bt, "overflow")
+	if top == nil || kf == nil || ef == nil || of == nil {
+		return n, nil, nil, nil, nil, fmt.Errorf("unexpected bucket type %v", bt)
+	}
+
+	walk := func(base, count uint64) error {
+		for i := uint64(0); i < count; i++ {
+			for bkt := base + i*uint64(bt.Size()); bkt != 0; {
+				th, err := vp.r.Bytes(bkt+uint64(top.ByteOffset), groupSlots)
+				if err != nil {
+					return err
+				}
+				for j := 0; j < groupSlots; j++ {
+					if th[j] < minTopHash {
+						continue
+					}
+					if len(keys) == vp.MaxLen {
+						return nil
+					}
+					keys = append(keys, bkt+uint64(kf.ByteOffset)+uint64(j)*uint64(kt.Size()))
+					elems = append(elems, bkt+uint64(ef.ByteOffset)+uint64(j)*uint64(et.Size()))
+				}
+				if bkt, err = vp.r.Ptr(bkt + uint64(of.ByteOffset)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if B > 32 {
+		return n, nil, nil, kt, et, fmt.Errorf("invalid bucket count 2^%d", B)
+	}
+	if err = walk(buckets, 1<<B); err == nil && old != 0 {
+		// not yet evacuated cells of the old array during growth
+		oldB := B - 1
+		if flags&sameSizeGrow != 0 || B == 0 {
+			oldB = B
+		}
+		err = walk(old, 1<<oldB)
+	}
+
+	return n, keys, elems, kt, et, err
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/debug/elf"
+)
+
+var gcoreFilter = flag.String("dump-filter", "", "gcore: mappings to dump, hex coredump_filter or names like anon-private,file-private,-elf-headers (/proc/<pid>/coredump_filter)")
+var gcoreSkipText = flag.Bool("skip-text", false, "gcore: do not dump read-only file mappings")
+var gcoreSparse = flag.Bool("sparse", false, "gcore: leave pages of zeros as holes in the core file")
+
+// gcorePolicy builds the dump policy from the flags, the filter of the
+// process is used by default as the kernel does.
+func gcorePolicy(pid int) (*elf2.DumpPolicy, error) {
+	p := &elf2.DumpPolicy{SkipText: *gcoreSkipText, Sparse: *gcoreSparse}
+	var err error
+	if *gcoreFilter != "" {
+		p.Filter, err = elf2.ParseDumpFilter(*gcoreFilter)
+	} else {
+		p.Filter, err = elf2.ReadProcDumpFilter(pid)
+	}
+	return p, err
+}
+
+// Gcore stops the process, writes its core dump into output (core.<pid>
+// by default) and resumes the process.
+func Gcore(arg, output string) error {
+	pid, err := strconv.Atoi(arg)
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("invalid pid %q", arg)
+	}
+	if output == "" {
+		output = fmt.Sprintf("core.%d", pid)
+	}
+
+	exe, err := Open(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return err
+	}
+	// registers are read in the layout of the tracer
+	native := elf.ELFCLASS64
+	if strconv.IntSize == 32 {
+		native = elf.ELFCLASS32
+	}
+	if exe.Class != native {
+		return fmt.Errorf("unsupported elf class %v", exe.Class)
+	}
+
+	policy, err := gcorePolicy(pid)
+	if err != nil {
+		return err
+	}
+
+	t, err := elf2.SeizeProcess(pid)
+	if err != nil {
+		return err
+	}
+	defer t.Detach()
+
+	// smaps tells the modified pages and madvise flags of the mappings
+	maps, err := elf2.ReadProcSmaps(pid)
+	if err != nil {
+		if maps, err = elf2.ReadProcMaps(pid); err != nil {
+			return err
+		}
+	}
+
+	cw := elf2.NewCoreWriter(exe.Class, exe.ByteOrder, exe.Machine)
+	cw.OSABI = exe.OSABI
+	cw.Policy = policy
+	cw.PageSize = uint64(os.Getpagesize())
+	if cw.Notes, err = gcoreNotes(t, maps, cw); err != nil {
+		return err
+	}
+
+	mem, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
+	if err != nil {
+		return err
+	}
+	defer mem.Close()
+
+	for _, m := range maps {
+		if m.End > 1<<63 {
+			continue
+		}
+		cw.AddMapping(m, mem)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	// holes are made by seeking the file
+	if policy.Sparse {
+		_, err = cw.WriteTo(f)
+	} else {
+		w := bufio.NewWriterSize(f, 1<<20)
+		if _, err = cw.WriteTo(w); err == nil {
+			err = w.Flush()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if cw.Unreadable > 0 {
+		fmt.Fprintf(os.Stderr, "%d bytes of memory could not be read and are written as zeros\n", cw.Unreadable)
+	}
+	var dumped uint64
+	for _, s := range cw.Segments {
+		dumped += s.Filesz
+	}
+	fmt.Printf("Saved core of %d (%d threads, %d segments, %d bytes dumped, filter %v) to %v\n", pid, len(t.Threads), len(cw.Segments), dumped, policy.Filter, output)
+	return nil
+}
+
+// gcoreNotes builds the notes in the order the kernel writes them: the
+// first thread status, the process notes, then the rest of the threads.
+func gcoreNotes(t *elf2.Tracee, maps []*elf2.Mapping, cw *elf2.CoreWriter) ([]*elf2.Note, error) {
+	pid, o, c := t.Pid, cw.Order, cw.Class
+
+	auxvData, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid))
+	if err != nil {
+		return nil, err
+	}
+	// thread times are in clock ticks
+	hz := uint64(100)
+	if auxv, err := elf2.ParseAuxv(auxvData, o, c); err == nil {
+		for _, a := range auxv {
+			if a.Tag == elf2.AT_CLKTCK && a.Val != 0 {
+				hz = a.Val
+			}
+		}
+	}
+
+	psinfo, err := gcorePSInfo(pid)
+	if err != nil {
+		return nil, err
+	}
+	var files []elf2.FileMapping
+	for _, m := range maps {
+		if strings.HasPrefix(m.File, "/") {
+			files = append(files, elf2.FileMapping{Start: m.Start, End: m.End, Off: m.Off, Name: m.File})
+		}
+	}
+
+	process := []struct {
+		t elf2.NoteType
+		f func() ([]byte, error)
+	}{
+		{elf2.NT_PRPSINFO, func() ([]byte, error) { return elf2.EncodePRPSInfo(psinfo, o, c) }},
+		{elf2.NT_SIGINFO, func() ([]byte, error) { return elf2.EncodeSigInfo(&elf2.SigInfo{}, o, c) }},
+		{elf2.NT_AUXV, func() ([]byte, error) { return auxvData, nil }},
+		{elf2.NT_FILE, func() ([]byte, error) { return elf2.EncodeFileNote(files, cw.PageSize, o, c) }},
+	}
+
+	var notes []*elf2.Note
+	for i, th := range t.Threads {
+		st, err := elf2.ReadProcStat(pid, th.Tid)
+		if err != nil {
+			return nil, err
+		}
+		tv := func(ticks uint64) elf2.TimeVal {
+			return elf2.TimeVal{Sec: elf2.KernelTime(ticks / hz), USec: elf2.KernelSUSeconds(ticks % hz * 1000000 / hz)}
+		}
+		prs := &elf2.PRStatus{
+			PID:    elf2.KernelPid(th.Tid),
+			PPID:   elf2.KernelPid(st.PPid),
+			PGRP:   elf2.KernelPid(st.PGrp),
+			SID:    elf2.KernelPid(st.Session),
+			UTime:  tv(st.UTime),
+			STime:  tv(st.STime),
+			CUTime: tv(st.CUTime),
+			CSTime: tv(st.CSTime),
+			Regs:   th.Regs,
+		}
+		data, err := elf2.EncodePRStatus(prs, o, c)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, &elf2.Note{Name: "CORE", Type: elf2.NT_PRSTATUS, Data: data})
+
+		if i == 0 {
+			for _, pn := range process {
+				data, err := pn.f()
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", pn.t, err)
+				}
+				notes = append(notes, &elf2.Note{Name: "CORE", Type: pn.t, Data: data})
+			}
+		}
+		if th.FPRegs != nil {
+			notes = append(notes, &elf2.Note{Name: "CORE", Type: elf2.NT_PRFPREG, Data: th.FPRegs})
+		}
+	}
+
+	return notes, nil
+}
+
+// gcorePSInfo collects NT_PRPSINFO from /proc.
+func gcorePSInfo(pid int) (*elf2.PRPSInfo, error) {
+	st, err := elf2.ReadProcStat(pid, pid)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, err := elf2.ReadProcIDs(pid)
+	if err != nil {
+		return nil, err
+	}
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	state := strings.IndexByte("RSDTZW", st.State)
+	if state < 0 {
+		state = 0
+	}
+	prps := &elf2.PRPSInfo{
+		State:  byte(state),
+		SName:  string(st.State),
+		Nice:   byte(int8(st.Nice)),
+		Flag:   uint(st.Flags),
+		UID:    elf2.KernelUid(uid),
+		GID:    elf2.KernelGid(gid),
+		PID:    elf2.KernelPid(pid),
+		PPID:   elf2.KernelPid(st.PPid),
+		PGRP:   elf2.KernelPid(st.PGrp),
+		SID:    elf2.KernelPid(st.Session),
+		FName:  st.Comm,
+		PSArgs: strings.TrimRight(strings.Replace(string(cmdline), "\x00", " ", -1), " "),
+	}
+	if st.State == 'Z' {
+		prps.Zomb = 1
+	}
+
+	return prps, nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+)
+
+var stacksLimit = flag.Int("stacks", 5, "triage, core goroutines: groups of identical goroutine stacks to print (0 for all)")
+var ignoreLines = flag.Bool("ignore-lines", false, "triage, core goroutines: group goroutine stacks by functions regardless of lines")
+var ignoreArgs = flag.Bool("ignore-args", false, "triage, core goroutines: group goroutine stacks regardless of argument values")
+
+// StackFrame is a symbolized frame.
+type StackFrame struct {
+	PC   uint64 `json:"pc"`
+	Func string `json:"func"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// Args are the words of the arguments as the runtime prints them.
+	Args string `json:"args,omitempty"`
+}
+
+// StackBucket is a group of goroutines with identical stacks.
+type StackBucket struct {
+	Count  int            `json:"count"`
+	States map[string]int `json:"states"`
+	// LongestWait is the longest wait of the goroutines, 0 if unknown.
+	LongestWait time.Duration `json:"longest_wait,omitempty"`
+	Goroutines  []uint64      `json:"goroutines"`
+	Frames      []StackFrame  `json:"frames"`
+}
+
+// FuncTab returns the function table of .gopclntab.
+func (p *Process) FuncTab() (*elf2.FuncTab, error) {
+	s := p.efd.Section(".gopclntab")
+	if s == nil {
+		return nil, fmt.Errorf("no .gopclntab section")
+	}
+	data, err := elf2.SectionData(p.efd, s)
+	if err != nil {
+		return nil, err
+	}
+	var text uint64
+	if t := p.efd.Section(".text"); t != nil {
+		text = t.Addr
+	}
+	tab, err := elf2.NewFuncTab(data, text)
+	if err != nil {
+		return nil, err
+	}
+	// inlined calls are not expanded without moduledata
+	if md, err := p.ModuleData(); err == nil {
+		tab.GoFunc = md.GoFunc
+	}
+	return tab, nil
+}
+
+// Threads returns the threads of the core in the order of NT_PRSTATUS
+// notes, the first one got the signal.
+func (p *Process) Threads() ([]elf2.Thread, error) {
+	if p.core == nil {
+		return nil, fmt.Errorf("threads need --core")
+	}
+	notes, err := elf2.ReadAllNotes(p.core)
+	if err != nil {
+		return nil, err
+	}
+	var threads []elf2.Thread
+	for _, n := range notes {
+		if n.Name != "CORE" || n.Type != elf2.NT_PRSTATUS {
+			continue
+		}
+		prs, err := elf2.ReadPRStatus(n, p.core.ByteOrder, p.core.Class)
+		if err != nil {
+			return nil, err
+		}
+		regs := elf2.GetUserRegs(prs.Regs)
+		threads = append(threads, elf2.Thread{Tid: uint64(prs.PID), PC: uint64(regs.IP), SP: uint64(regs.SP)})
+	}
+	return threads, nil
+}
+
+// Unwinder returns the stack unwinder of the process memory.
+func (p *Process) Unwinder() (*elf2.Unwinder, error) {
+	tab, err := p.FuncTab()
+	if err != nil {
+		return nil, err
+	}
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return nil, err
+	}
+	return elf2.NewUnwinder(r, tab, p.efd.Machine)
+}
+
+// Goroutines reads and unwinds the goroutines. Without a core the running
+// goroutines are unwound from the context saved by the scheduler only.
+func (p *Process) Goroutines() ([]*elf2.Goroutine, error) {
+	d, err := p.DWARF()
+	if err != nil {
+		return nil, err
+	}
+	u, err := p.Unwinder()
+	if err != nil {
+		return nil, err
+	}
+	var threads []elf2.Thread
+	if p.core != nil {
+		if threads, err = p.Threads(); err != nil {
+			return nil, err
+		}
+	}
+	return elf2.ReadGoroutines(u.R, d, u, threads)
+}
+
+// StackFrames symbolizes the frames.
+func (p *Process) StackFrames(frames []elf2.Frame) []StackFrame {
+	var sf []StackFrame
+	for _, f := range frames {
+		s := StackFrame{PC: f.PC, Func: f.Func, Args: f.Args}
+		if s.Func == "" {
+			s.Func = p.Symbolize(f.PC)
+		}
+		s.File, s.Line, _ = p.PCToLine(f.LookupPC())
+		sf = append(sf, s)
+	}
+	return sf
+}
+
+// goroutineState is the state of the goroutine with the wait reason.
+func goroutineState(g *elf2.Goroutine) string {
+	if g.WaitReason != "" {
+		return g.State + " (" + g.WaitReason + ")"
+	}
+	return g.State
+}
+
+// BucketGoroutines groups the goroutines by identical symbolized stacks,
+// the biggest groups first. Without lines stacks are compared by the
+// functions only, and the frames of the bucket have just the names.
+// Without args the argument values are not compared and dropped. The
+// waits are measured at the nanotime now.
+func (p *Process) BucketGoroutines(gs []*elf2.Goroutine, now int64, lines, args bool) []*StackBucket {
+	index := map[string]*StackBucket{}
+	var buckets []*StackBucket
+	for _, g := range gs {
+		frames := p.StackFrames(g.Frames)
+		var key strings.Builder
+		for i := range frames {
+			if !lines {
+				frames[i] = StackFrame{Func: frames[i].Func, Args: frames[i].Args}
+			}
+			if !args {
+				frames[i].Args = ""
+			}
+			fmt.Fprintf(&key, "%s(%s) %s:%d\n", frames[i].Func, frames[i].Args, frames[i].File, frames[i].Line)
+		}
+		b := index[key.String()]
+		if b == nil {
+			b = &StackBucket{States: map[string]int{}, Frames: frames}
+			index[key.String()] = b
+			buckets = append(buckets, b)
+		}
+		b.Count++
+		b.States[goroutineState(g)]++
+		b.Goroutines = append(b.Goroutines, g.ID)
+		if wait := g.Wait(now); wait > b.LongestWait {
+			b.LongestWait = wait
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].Count > buckets[j].Count })
+	return buckets
+}
+
+// PrintGoroutines prints the goroutines grouped by identical stacks.
+// Goroutines are found by DWARF, without it the threads of a core are
+// unwound by pclntab instead.
+func (p *Process) PrintGoroutines() error {
+	gs, err := p.Goroutines()
+	if err != nil {
+		return p.printThreadStacks(err)
+	}
+	u, err := p.Unwinder()
+	if err != nil {
+		return err
+	}
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	buckets := p.BucketGoroutines(gs, elf2.Nanotime(u.R, d, gs), !*ignoreLines, !*ignoreArgs)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(buckets)
+	}
+	fmt.Printf("%d goroutines, %d stacks\n", len(gs), len(buckets))
+	printBuckets(buckets)
+	return nil
+}
+
+// printThreadStacks prints the stacks of the threads of the core when the
+// goroutines could not be read because of err.
+func (p *Process) printThreadStacks(err error) error {
+	if p.core == nil {
+		return err
+	}
+	threads, terr := p.Threads()
+	if terr != nil {
+		return err
+	}
+	u, terr := p.Unwinder()
+	if terr != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Error reading goroutines:", err)
+
+	stacks := p.ThreadStacks(u, threads)
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stacks)
+	}
+	fmt.Printf("%d threads, goroutines unknown\n", len(stacks))
+	printThreads(stacks)
+	return nil
+}
+
+func printBuckets(buckets []*StackBucket) {
+	for i, b := range buckets {
+		if *stacksLimit > 0 && i >= *stacksLimit {
+			fmt.Printf("\n... %d more stacks\n", len(buckets)-i)
+			break
+		}
+		var states []string
+		for s, n := range b.States {
+			states = append(states, fmt.Sprintf("%s=%d", s, n))
+		}
+		sort.Strings(states)
+		fmt.Printf("\n%d goroutines [%s]", b.Count, strings.Join(states, " "))
+		if b.LongestWait >= time.Second {
+			fmt.Printf(" waiting up to %v", b.LongestWait.Round(time.Second))
+		} else if b.LongestWait > 0 {
+			fmt.Printf(" waiting up to %v", b.LongestWait.Round(time.Millisecond))
+		}
+		fmt.Print(":")
+		for k, id := range b.Goroutines {
+			if k == 8 {
+				fmt.Print(" ...")
+				break
+			}
+			fmt.Printf(" %d", id)
+		}
+		fmt.Println()
+		printFrames(b.Frames)
+	}
+}
+
+func printFrames(frames []StackFrame) {
+	for _, f := range frames {
+		if f.Args != "" {
+			fmt.Printf("  %s(%s)\n", f.Func, f.Args)
+		} else {
+			fmt.Printf("  %s\n", f.Func)
+		}
+		switch {
+		case f.File != "" && f.Line != 0:
+			fmt.Printf("  \t%s:%d\n", f.File, f.Line)
+		case f.PC != 0:
+			fmt.Printf("  \t0x%x\n", f.PC)
+		}
+	}
+}
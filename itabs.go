@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+func (p *Process) PrintITabs() {
+	tr, err := p.TypeReader()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading moduledata:", err)
+		return
+	}
+
+	itabs, err := tr.ITabs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading itabs:", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{
+		"Itab", "Type", "Interface", "Method", "Addr", "Func",
+	})
+	table.SetBorder(false)
+	table.SetAutoWrapText(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+
+	for _, it := range itabs {
+		row := []string{
+			fmt.Sprintf("0x%x", it.Addr),
+			tr.TypeName(it.Type),
+			tr.TypeName(it.Inter),
+		}
+
+		inter, err := tr.Type(it.Inter)
+		if err != nil || len(inter.IMethods) == 0 || it.Fun[0] == 0 {
+			table.Append(append(row, "", "", ""))
+			continue
+		}
+
+		for i, m := range inter.IMethods {
+			if i > 0 {
+				row = []string{"", "", ""}
+			}
+			table.Append(append(row,
+				m.Name,
+				fmt.Sprintf("0x%x", it.Fun[i]),
+				p.Symbolize(it.Fun[i]),
+			))
+		}
+	}
+
+	table.Render()
+	fmt.Println()
+}
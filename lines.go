@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PrintLines dumps the line tables of all compile units or, given
+// file:line, lists the statement addresses of the line.
+func (p *Process) PrintLines(arg string) error {
+	lines, err := p.Lines()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	if arg != "" {
+		i := strings.LastIndex(arg, ":")
+		if i < 0 {
+			return fmt.Errorf("expected file:line, got %q", arg)
+		}
+		line, err := strconv.Atoi(arg[i+1:])
+		if err != nil {
+			return fmt.Errorf("invalid line %q: %v", arg[i+1:], err)
+		}
+
+		pcs, file := lines.LineToPCs(arg[:i], line)
+		if file == "" {
+			return fmt.Errorf("file %v not found", arg[:i])
+		}
+		if len(pcs) == 0 {
+			return fmt.Errorf("no code at %v:%d", file, line)
+		}
+		for _, pc := range pcs {
+			fmt.Fprintf(w, "0x%x\t%s\t%s:%d\n", pc, p.Symbolize(pc), file, line)
+		}
+		return nil
+	}
+
+	for _, t := range lines.Tables {
+		fmt.Fprintf(w, "Line table 0x%x version %d files %d rows %d\n", t.Offset, t.Version, len(t.Files), len(t.Rows))
+		for _, r := range t.Rows {
+			var flags []string
+			if r.IsStmt {
+				flags = append(flags, "is_stmt")
+			}
+			if r.EndSequence {
+				flags = append(flags, "end_sequence")
+			}
+			fmt.Fprintf(w, "\t0x%x\t%s:%d:%d\t%s\n", r.Addr, r.File, r.Line, r.Column, strings.Join(flags, " "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
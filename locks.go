@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	elf2 "github.com/sitano/goelf/elf"
+)
+
+// LockObject is a lock or a channel goroutines are blocked on.
+type LockObject struct {
+	Addr    uint64   `json:"addr"`
+	Kind    string   `json:"kind"`
+	State   string   `json:"state"`
+	Waiters []uint64 `json:"waiters"`
+	Holders []uint64 `json:"holders,omitempty"`
+}
+
+// LocksReport is the JSON output of core locks.
+type LocksReport struct {
+	// Deadlocks are the groups of goroutines waiting for each other.
+	Deadlocks [][]uint64    `json:"deadlocks,omitempty"`
+	Objects   []*LockObject `json:"objects"`
+}
+
+// PrintLocks prints the locks and channels the goroutines are blocked on,
+// who may hold them and the goroutines waiting for each other.
+func (p *Process) PrintLocks() error {
+	gs, err := p.Goroutines()
+	if err != nil {
+		return err
+	}
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	u, err := p.Unwinder()
+	if err != nil {
+		return err
+	}
+	w, err := elf2.ReadWaitGraph(u, d, gs)
+	if err != nil {
+		return err
+	}
+	cycles := w.Cycles()
+
+	if *jsonOutput {
+		rep := &LocksReport{Objects: []*LockObject{}}
+		for _, cycle := range cycles {
+			rep.Deadlocks = append(rep.Deadlocks, goroutineIDs(cycle))
+		}
+		for _, o := range w.Objects {
+			rep.Objects = append(rep.Objects, &LockObject{
+				Addr:    o.Addr,
+				Kind:    o.Kind,
+				State:   o.State,
+				Waiters: goroutineIDs(o.Waiters),
+				Holders: goroutineIDs(o.Holders),
+			})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+
+	for _, cycle := range cycles {
+		fmt.Printf("Deadlock of %d goroutines:\n", len(cycle))
+		for _, g := range cycle {
+			for _, o := range w.Waits[g] {
+				fmt.Printf("  %d at %s waits on %s %s %s\n",
+					g.ID, p.waitSite(g), objectName(o), heldBy(o), listIDs(o.Holders, 8))
+			}
+		}
+		fmt.Println()
+	}
+
+	if len(w.Objects) == 0 {
+		fmt.Println("No goroutines are blocked on locks or channels")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Object", "State", "Waiters", "Waiting at", "Maybe held or used by"})
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAutoWrapText(false)
+	for _, o := range w.Objects {
+		table.Append([]string{
+			objectName(o),
+			o.State,
+			fmt.Sprintf("%d: %s", len(o.Waiters), listIDs(o.Waiters, 8)),
+			p.waitSite(o.Waiters[0]),
+			listIDs(o.Holders, 8),
+		})
+	}
+	table.Render()
+
+	var chains []string
+	for _, o := range w.Objects {
+		chain, cycle := w.Chain(o)
+		if len(chain) < 2 {
+			continue
+		}
+		var b strings.Builder
+		for i, l := range chain {
+			if i > 0 {
+				b.WriteString(" waiting on ")
+			}
+			b.WriteString(objectName(l.Object))
+			switch {
+			case l.Holder != nil:
+				fmt.Fprintf(&b, " %s %d", heldBy(l.Object), l.Holder.ID)
+			case !cycle || i < len(chain)-1:
+				// the chain may go on through an unknown holder
+				fmt.Fprintf(&b, " %s ?", heldBy(l.Object))
+			}
+		}
+		if cycle {
+			b.WriteString(" (cycle)")
+		}
+		chains = append(chains, b.String())
+	}
+	if len(chains) > 0 {
+		fmt.Println("\nWait chains:")
+		for _, c := range chains {
+			fmt.Println(" ", c)
+		}
+	}
+	return nil
+}
+
+func objectName(o *elf2.WaitObject) string {
+	return fmt.Sprintf("%s 0x%x", o.Kind, o.Addr)
+}
+
+// heldBy tells how the holders relate to the object: they hold locks and
+// may send or receive on channels.
+func heldBy(o *elf2.WaitObject) string {
+	if o.Kind == "chan" {
+		return "used by"
+	}
+	return "held by"
+}
+
+// waitSite returns the innermost frame of the goroutine out of the
+// runtime and the sync packages.
+func (p *Process) waitSite(g *elf2.Goroutine) string {
+	for _, f := range p.StackFrames(g.Frames) {
+		if strings.HasPrefix(f.Func, "runtime.") || strings.HasPrefix(f.Func, "sync.") || strings.HasPrefix(f.Func, "internal/sync.") {
+			continue
+		}
+		return fmt.Sprintf("%s %s:%d", f.Func, filepath.Base(f.File), f.Line)
+	}
+	return ""
+}
+
+func goroutineIDs(gs []*elf2.Goroutine) []uint64 {
+	var ids []uint64
+	for _, g := range gs {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+// listIDs lists at most max ids of the goroutines, ? if there are none.
+func listIDs(gs []*elf2.Goroutine, max int) string {
+	if len(gs) == 0 {
+		return "?"
+	}
+	var ids []string
+	for i, g := range gs {
+		if i == max {
+			ids = append(ids, "...")
+			break
+		}
+		ids = append(ids, fmt.Sprint(g.ID))
+	}
+	return strings.Join(ids, " ")
+}
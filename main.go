@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -13,6 +14,8 @@ import (
 )
 
 var filename = flag.StringP("filename", "f", "", "Path to the elf binary")
+var coreFile = flag.StringP("core", "c", "", "Path to the core dump of the process running the binary")
+var pid = flag.IntP("pid", "p", 0, "Pid of the live process to read memory of instead of a core (implies -f /proc/<pid>/exe)")
 var all = flag.BoolP("all", "a", false, "Print all available information")
 var header = flag.Bool("header", false, "Print header")
 var sections = flag.Bool("sections", false, "Print sections")
@@ -22,10 +25,156 @@ var progs = flag.Bool("progs", false, "Print progs")
 var notes = flag.Bool("notes", false, "Print notes")
 var note_prstatus = flag.Bool("note_prstatus", false, "Print prstatus note")
 var note_prpsinfo = flag.Bool("note_prpsinfo", false, "Print prpsinfo note")
+var moduledata = flag.Bool("moduledata", false, "Print runtime.firstmoduledata")
+var types = flag.Bool("types", false, "Print Go runtime types from typelinks")
+var itabs = flag.Bool("itabs", false, "Print interface tables from itablinks")
+var dumpSection = flag.String("dump-section", "", "Write raw (decompressed) section contents to stdout")
+var strict = flag.Bool("strict", false, "Fail if the core does not match the executable")
+var debugDirs = flag.StringSlice("debug-dir", []string{}, "Directories to search separate debug files (build-id and .gnu_debuglink) and executables of cores (build-id) in")
+var sysroot = flag.String("sysroot", "", "Root directory to look for the files mapped in cores in")
+
+// commandFlags are the commands the flags of commands apply to, by the
+// leading words of the command line, "" for none. The other flags apply
+// to all commands.
+var commandFlags = map[string][]string{
+	"header":        {""},
+	"sections":      {""},
+	"symbols":       {""},
+	"imports":       {""},
+	"progs":         {""},
+	"notes":         {""},
+	"note_prstatus": {""},
+	"note_prpsinfo": {""},
+	"moduledata":    {""},
+	"types":         {""},
+	"itabs":         {""},
+	"dump-section":  {""},
+	"all":           {""},
+
+	"section": {"dump"},
+	"segment": {"dump"},
+	"vaddr":   {"dump"},
+	"output":  {"dump", "gcore", "core redact"},
+
+	"dump-filter": {"gcore"},
+	"skip-text":   {"gcore"},
+	"sparse":      {"gcore"},
+
+	"min-len": {"strings"},
+	"max-len": {"strings"},
+
+	"kind":  {"dwarf"},
+	"regex": {"dwarf"},
+	"depth": {"dwarf"},
+	"json":  {"dwarf", "triage", "core goroutines", "core locks"},
+
+	"source": {"disasm"},
+
+	"value-depth": {"core", "triage"},
+	"value-len":   {"core", "triage"},
+	"top":         {"core heap"},
+
+	"stacks":       {"triage", "core goroutines"},
+	"ignore-lines": {"triage", "core goroutines"},
+	"ignore-args":  {"triage", "core goroutines"},
+
+	"keep":       {"core redact"},
+	"keep-types": {"core redact"},
+}
+
+// checkFlags fails on a flag set for another command than the one of
+// args.
+func checkFlags(args []string) error {
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		cmds, ok := commandFlags[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		for _, cmd := range cmds {
+			if cmd == "" {
+				if len(args) == 0 {
+					return
+				}
+				continue
+			}
+			n := len(strings.Fields(cmd))
+			if n <= len(args) && strings.Join(args[:n], " ") == cmd {
+				return
+			}
+		}
+		if len(cmds) == 1 && cmds[0] == "" {
+			err = fmt.Errorf("--%s does not apply to commands", f.Name)
+		} else {
+			err = fmt.Errorf("--%s applies to %s only", f.Name, strings.Join(cmds, ", "))
+		}
+	})
+	return err
+}
 
 func main() {
 	flag.Parse()
 
+	if err := checkFlags(flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	// gcore works on the process only
+	if flag.Arg(0) == "gcore" {
+		if err := Gcore(flag.Arg(1), *dumpOutput); err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing core:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *filename == "" && *pid != 0 {
+		*filename = fmt.Sprintf("/proc/%d/exe", *pid)
+	}
+
+	// the objects of a core are listed to find what is missing
+	if flag.Arg(0) == "core" && flag.Arg(1) == "objects" {
+		if *coreFile == "" {
+			fmt.Fprintln(os.Stderr, "Core is required")
+			os.Exit(1)
+		}
+		if err := PrintCoreObjects(*coreFile, *debugDirs); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading core:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// triage takes the core and optionally the executable as arguments
+	if flag.Arg(0) == "triage" {
+		if *coreFile == "" {
+			*coreFile = flag.Arg(1)
+		}
+		if *filename == "" && flag.Arg(2) != "" {
+			*filename = flag.Arg(2)
+		}
+		if *coreFile == "" {
+			fmt.Fprintln(os.Stderr, "Core is required")
+			os.Exit(1)
+		}
+	}
+
+	// the executable of a core is found by NT_FILE
+	if *filename == "" && *coreFile != "" {
+		core, err := Open(*coreFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening core", err)
+			os.Exit(1)
+		}
+		if *filename, err = elf2.FindCoreExecutable(core, *sysroot, *debugDirs); err != nil {
+			fmt.Fprintln(os.Stderr, "Error finding executable of the core (use -f):", err)
+			os.Exit(1)
+		}
+		core.Close()
+		fmt.Fprintln(os.Stderr, "Using executable", *filename)
+	}
+
 	if *filename == "" {
 		fmt.Fprintln(os.Stderr, "Filename is required")
 		os.Exit(1)
@@ -36,6 +185,77 @@ func main() {
 		fmt.Fprintln(os.Stderr, "Error opening file", err)
 		os.Exit(1)
 	}
+	p.debugDirs = *debugDirs
+
+	if *coreFile != "" {
+		if err := p.OpenCore(*coreFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening core", err)
+			os.Exit(1)
+		}
+		// core validate prints all the checks itself
+		if !(flag.Arg(0) == "core" && flag.Arg(1) == "validate") && !p.CheckCore() && *strict {
+			os.Exit(1)
+		}
+	} else if *pid != 0 {
+		// separate debug files are searched next to the real executable
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", *pid)); err == nil {
+			p.path = exe
+		}
+		if err := p.OpenPID(*pid); err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening process", err)
+			os.Exit(1)
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "dump":
+		if err := p.Dump(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error dumping:", err)
+			os.Exit(1)
+		}
+		return
+	case "strings":
+		if err := p.PrintStrings(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading strings:", err)
+			os.Exit(1)
+		}
+		return
+	case "dwarf":
+		if err := p.BrowseDWARF(flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading DWARF:", err)
+			os.Exit(1)
+		}
+		return
+	case "core":
+		if err := p.Core(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading core:", err)
+			os.Exit(1)
+		}
+		return
+	case "triage":
+		if err := p.Triage(); err != nil {
+			fmt.Fprintln(os.Stderr, "Error triaging core:", err)
+			os.Exit(1)
+		}
+		return
+	case "lines":
+		if err := p.PrintLines(flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading line tables:", err)
+			os.Exit(1)
+		}
+		return
+	case "disasm":
+		if err := p.Disasm(flag.Arg(1)); err != nil {
+			fmt.Fprintln(os.Stderr, "Error disassembling:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *dumpSection != "" {
+		p.DumpSection(*dumpSection)
+		return
+	}
 
 	if *all || *header {
 		p.PrintHeader()
@@ -65,6 +285,18 @@ func main() {
 		p.PrintPRPSInfo()
 	}
 
+	if *all || *moduledata {
+		p.PrintModuleData()
+	}
+
+	if *all || *types {
+		p.PrintTypes()
+	}
+
+	if *all || *itabs {
+		p.PrintITabs()
+	}
+
 	if *all || *symbols {
 		p.PrintSymbols()
 	}
@@ -124,6 +356,22 @@ func (p *Process) PrintSections() {
 	fmt.Println()
 }
 
+func (p *Process) DumpSection(name string) {
+	s := elf2.DebugSection(p.efd, name)
+	if s == nil {
+		fmt.Fprintln(os.Stderr, "Error searching for section", name)
+		os.Exit(1)
+	}
+
+	data, err := elf2.SectionData(p.efd, s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading", name, ":", err)
+		os.Exit(1)
+	}
+
+	os.Stdout.Write(data)
+}
+
 func (p *Process) PrintProgs() {
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{
@@ -158,7 +406,7 @@ func (p *Process) PrintSymbols() {
 	table.SetAutoWrapText(true)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 
-	sym, err := p.efd.Symbols()
+	sym, err := p.Symbols()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error reading .symtab", err)
 	}
@@ -238,29 +486,22 @@ func (p *Process) PrintNotes() {
 	table.SetAutoWrapText(true)
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 
-	s := p.efd.SectionByType(elf.SHT_NOTE)
-	if s == nil {
-		fmt.Fprintln(os.Stderr, "Error searching for note (7) section")
-	}
-
-	notes, err := elf2.ReadNotes(s, p.efd.ByteOrder)
+	notes, err := elf2.ReadAllNotes(p.efd)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error reading", s.Name, ":", err)
+		fmt.Fprintln(os.Stderr, "Error reading notes:", err)
 	}
 
 	for _, n := range notes {
-		typeString := fmt.Sprintf("%v", n.Type)
-
-		data := "..."
-
-		if n.Name == "Go" && n.Type == elf2.NT_GO_BUILD {
-			typeString = "NT_GOBUILDID"
-			data = string(n.Data)
+		data, err := elf2.DescribeNote(n, p.efd.ByteOrder, p.efd.Class)
+		if err != nil {
+			data = fmt.Sprintf("error: %v", err)
+		} else if data == "" {
+			data = "..."
 		}
 
 		table.Append([]string{
 			n.Name,
-			typeString,
+			n.TypeString(),
 			fmt.Sprintf("0x%x", len(n.Data)),
 			data,
 		})
@@ -271,12 +512,7 @@ func (p *Process) PrintNotes() {
 }
 
 func (p *Process) PrintPRStatus() {
-	s := p.efd.SectionByType(elf.SHT_NOTE)
-	if s == nil {
-		fmt.Fprintln(os.Stderr, "Error searching for note (7) section")
-	}
-
-	note, err := elf2.ReadNoteByType(s, p.efd.ByteOrder, elf2.NT_PRSTATUS)
+	note, err := p.coreNote(elf2.NT_PRSTATUS)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error reading NT_PRSTATUS:", err)
 		return
@@ -296,12 +532,7 @@ func (p *Process) PrintPRStatus() {
 }
 
 func (p *Process) PrintPRPSInfo() {
-	s := p.efd.SectionByType(elf.SHT_NOTE)
-	if s == nil {
-		fmt.Fprintln(os.Stderr, "Error searching for note (7) section")
-	}
-
-	note, err := elf2.ReadNoteByType(s, p.efd.ByteOrder, elf2.NT_PRPSINFO)
+	note, err := p.coreNote(elf2.NT_PRPSINFO)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error reading NT_PRPSINFO:", err)
 		return
@@ -317,6 +548,21 @@ func (p *Process) PrintPRPSInfo() {
 	fmt.Println()
 }
 
+// coreNote returns the first note of the type owned by "CORE". Cores
+// usually have no sections, so the notes are read from PT_NOTE too.
+func (p *Process) coreNote(t elf2.NoteType) (*elf2.Note, error) {
+	notes, err := elf2.ReadAllNotes(p.efd)
+	for _, n := range notes {
+		if n.Name == "CORE" && n.Type == t {
+			return n, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, errors.New("not found")
+}
+
 func PrintStruct(s interface{}, indent int) {
 	t := reflect.TypeOf(s)
 	v := reflect.ValueOf(s)
@@ -333,6 +579,8 @@ func PrintStruct(s interface{}, indent int) {
 		if ft.Kind() == reflect.Struct {
 			fmt.Printf("%s%s = ", ind, fn)
 			PrintStruct(v.Field(i).Interface(), indent + 1)
+		} else if ft.Kind() == reflect.Bool || ft.Kind() == reflect.String {
+			fmt.Printf("%s%s = %#v\n", ind, fn, vf.Interface())
 		} else {
 			fmt.Printf("%s%s = 0x%x (%v)\n", ind, fn, vf.Interface(), vf.Interface())
 		}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"debug/gosym"
+	"fmt"
 	"os"
 
 	"golang.org/x/debug/elf"
 	"golang.org/x/debug/dwarf"
+	elf2 "github.com/sitano/goelf/elf"
 )
 
 type Process struct {
@@ -12,12 +15,38 @@ type Process struct {
 
 	efd *elf.File
 	dwf *dwarf.Data
+	mem elf2.Memory
+
+	// core dump of the process, its memory is backed by efd
+	corePath string
+	core     *elf.File
+
+	// live process running the file, its memory is read from /proc
+	pid  int
+	proc *elf2.ProcMemory
+
+	md    *elf2.ModuleData
+	types *elf2.TypeReader
+	// DWARF types by runtime type descriptors
+	rtypes map[uint64]dwarf.Offset
+
+	gosym *gosym.Table
+	funcs []elf.Symbol
+	objs  []elf.Symbol
+	lines *elf2.Lines
+
+	linesErr error
+
+	// separate debug info file found by build-id or .gnu_debuglink
+	debugDirs []string
+	debugPath string
+	debugEfd  *elf.File
 }
 
 func New(path string) (*Process, error) {
 	var err error
 
-	p := &Process{}
+	p := &Process{path: path}
 	if p.efd, err = Open(path); err != nil {
 		return nil, err
 	}
@@ -25,11 +54,78 @@ func New(path string) (*Process, error) {
 	return p, nil
 }
 
+// OpenCore attaches the core dump of the process running the file.
+func (p *Process) OpenCore(path string) error {
+	core, err := Open(path)
+	if err != nil {
+		return err
+	}
+	if core.Type != elf.ET_CORE {
+		return fmt.Errorf("%v is not a core file: %v", path, core.Type)
+	}
+
+	p.corePath, p.core, p.mem = path, core, nil
+	return nil
+}
+
+// OpenPID attaches the running process. The file is expected to be the
+// executable of the process, i.e. /proc/<pid>/exe.
+func (p *Process) OpenPID(pid int) error {
+	proc, err := elf2.NewProcMemory(pid)
+	if err != nil {
+		return err
+	}
+
+	p.pid, p.proc, p.mem = pid, proc, nil
+	return nil
+}
+
+// Attached reports whether there is a core or a live process to read
+// memory of.
+func (p *Process) Attached() bool { return p.core != nil || p.proc != nil }
+
+// Auxv returns the auxiliary vector of the core or the live process.
+func (p *Process) Auxv() ([]elf2.Auxv, error) {
+	switch {
+	case p.proc != nil:
+		return elf2.ReadProcAuxv(p.pid, p.efd.ByteOrder, p.efd.Class)
+	case p.core != nil:
+		return elf2.CoreAuxv(p.core)
+	}
+	return nil, fmt.Errorf("--core or --pid is required")
+}
+
+// DebugFile returns the ELF file holding the debug info of the process.
+// It is the process file itself unless it is stripped and a separate
+// debug file can be found.
+func (p *Process) DebugFile() (*elf.File, error) {
+	if elf2.HasDWARF(p.efd) {
+		return p.efd, nil
+	}
+
+	if p.debugEfd == nil {
+		path, err := elf2.FindDebugFile(p.efd, p.path, p.debugDirs)
+		if err != nil {
+			return nil, err
+		}
+		if p.debugEfd, err = Open(path); err != nil {
+			return nil, err
+		}
+		p.debugPath = path
+	}
+
+	return p.debugEfd, nil
+}
+
 func (p *Process) DWARF() (*dwarf.Data, error) {
 	var err error
 
 	if p.dwf == nil {
-		if p.dwf, err = p.efd.DWARF(); err != nil {
+		efd, err := p.DebugFile()
+		if err != nil {
+			return nil, err
+		}
+		if p.dwf, err = elf2.LoadDWARF(efd); err != nil {
 			return nil, err
 		}
 	}
@@ -37,6 +133,26 @@ func (p *Process) DWARF() (*dwarf.Data, error) {
 	return  p.dwf, err
 }
 
+// Symbols returns .symtab of the process file or, if it is stripped,
+// of the separate debug file.
+func (p *Process) Symbols() ([]elf.Symbol, error) {
+	sym, err := p.efd.Symbols()
+	if err == nil && len(sym) > 0 {
+		return sym, nil
+	}
+
+	if p.efd.Section(".symtab") != nil {
+		return sym, err
+	}
+
+	efd, derr := p.DebugFile()
+	if derr != nil || efd == p.efd {
+		return sym, err
+	}
+
+	return efd.Symbols()
+}
+
 func Open(path string) (*elf.File, error) {
 	fd, err := os.OpenFile(path, 0, os.ModePerm)
 	if err != nil {
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+var redactKeep = flag.StringSlice("keep", nil, "core redact: address ranges addr:len to keep besides the stacks")
+var redactKeepTypes = flag.StringSlice("keep-types", nil, "core redact: keep the heap objects of the types, e.g. main.Request")
+
+// redZone is the area below the stack pointer leaf functions may use.
+const redZone = 128
+
+// Redact writes the copy of the core with the memory zeroed except the
+// stacks, the runtime structures, the read-only file mappings and what
+// is asked to keep. Arguments and environment strings are scrubbed from
+// the initial stack and NT_PRPSINFO. Other notes are kept as is.
+func (p *Process) Redact(output string) error {
+	if p.core == nil {
+		return fmt.Errorf("core redact needs --core")
+	}
+	if output == "" {
+		return fmt.Errorf("--output is required")
+	}
+	o, c := p.core.ByteOrder, p.core.Class
+
+	d, err := p.DWARF()
+	if err != nil {
+		return err
+	}
+	r, err := elf2.NewMemReader(p.Memory(), o, c)
+	if err != nil {
+		return err
+	}
+	coreMem := elf2.NewProgMemory(p.core)
+
+	stacks, err := elf2.GoroutineStacks(r, d)
+	if err != nil {
+		return fmt.Errorf("goroutine stacks: %v", err)
+	}
+	keep := append(elf2.AddrRanges(nil), stacks...)
+	runtime, err := elf2.RuntimeRanges(r, d)
+	if err != nil {
+		return fmt.Errorf("runtime structures: %v", err)
+	}
+	keep = append(keep, runtime...)
+
+	for _, s := range *redactKeep {
+		a, n, err := parseRange(s)
+		if err != nil {
+			return err
+		}
+		keep = keep.Add(a, a+n)
+	}
+
+	if len(*redactKeepTypes) > 0 {
+		objects, err := p.heapObjectsOf(r, d, *redactKeepTypes)
+		if err != nil {
+			return err
+		}
+		keep = append(keep, objects...)
+	}
+
+	notes, err := elf2.ReadAllNotes(p.core)
+	if err != nil {
+		return err
+	}
+
+	var scrub elf2.AddrRanges
+	var args, env int
+	for _, n := range notes {
+		if n.Name != "CORE" {
+			continue
+		}
+		switch n.Type {
+		case elf2.NT_PRSTATUS:
+			// threads outside of Go stacks, e.g. in cgo
+			prs, err := elf2.ReadPRStatus(n, o, c)
+			if err != nil {
+				return err
+			}
+			sp := uint64(elf2.GetUserRegs(prs.Regs).SP)
+			if m := elf2.FindMapping(coreMem, sp); m != nil && !stacks.Overlaps(sp, sp+1) {
+				keep = keep.Add(sp-redZone, m.End)
+			}
+		case elf2.NT_AUXV:
+			s, err := elf2.FindInitialStack(coreMem, n.Data, o, c)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Initial stack is not found:", err)
+				continue
+			}
+			keep = keep.Add(s.Start, s.End)
+			scrub = append(append(scrub, s.Args...), s.Env...)
+			args, env = len(s.Args), len(s.Env)
+		case elf2.NT_FILE:
+			// code and constants are in the files anyway
+			files, err := elf2.ReadFileNote(n, o, c)
+			if err != nil {
+				return err
+			}
+			for _, m := range coreMem.Mappings() {
+				if m.Flags&elf.PF_W != 0 {
+					continue
+				}
+				for _, f := range files {
+					if f.Start < m.End && m.Start < f.End {
+						keep = keep.Add(m.Start, m.End)
+						break
+					}
+				}
+			}
+		case elf2.NT_PRPSINFO:
+			prps, err := elf2.ReadPRPSInfo(n, o, c)
+			if err != nil {
+				return err
+			}
+			if fields := strings.Fields(prps.PSArgs); len(fields) > 0 {
+				prps.PSArgs = fields[0]
+			}
+			if n.Data, err = elf2.EncodePRPSInfo(prps, o, c); err != nil {
+				return err
+			}
+		}
+	}
+	keep, scrub = keep.Merge(), scrub.Merge()
+
+	cw := elf2.NewCoreWriter(c, o, p.core.Machine)
+	cw.OSABI = p.core.OSABI
+	cw.Notes = notes
+	cw.Policy = &elf2.DumpPolicy{Sparse: true}
+	data := &elf2.RedactedReader{R: coreMem, Keep: keep, Scrub: scrub}
+	var total, kept uint64
+	for _, prog := range p.core.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if prog.Align > 1 && prog.Align&(prog.Align-1) == 0 {
+			cw.PageSize = prog.Align
+		}
+		s := &elf2.CoreSegment{Vaddr: prog.Vaddr, Memsz: prog.Memsz, Flags: prog.Flags, Data: data}
+		// segments with nothing left are reported as not dumped
+		if keep.Overlaps(prog.Vaddr, prog.Vaddr+prog.Filesz) {
+			s.Filesz = prog.Filesz
+			kept += (elf2.AddrRanges{{Start: prog.Vaddr, End: prog.Vaddr + prog.Filesz}}).Intersect(keep).Size()
+		}
+		total += prog.Filesz
+		cw.AddSegment(s)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	_, err = cw.WriteTo(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Saved redacted core to %v: kept %d of %d bytes, scrubbed %d arguments and %d environment strings\n", output, kept, total, args, env)
+	return nil
+}
+
+// heapObjectsOf returns the heap objects of the named types. Only the
+// objects with the type known to the heap (Go 1.22+) are found.
+func (p *Process) heapObjectsOf(r *elf2.MemReader, d *dwarf.Data, names []string) (elf2.AddrRanges, error) {
+	tr, err := p.TypeReader()
+	if err != nil {
+		return nil, err
+	}
+	want := map[string]bool{}
+	for _, n := range names {
+		want[n] = true
+	}
+
+	var rs elf2.AddrRanges
+	types := map[uint64]bool{}
+	err = elf2.WalkHeap(r, d, nil, func(o elf2.HeapObject) error {
+		if o.Type == 0 {
+			return nil
+		}
+		match, ok := types[o.Type]
+		if !ok {
+			match = want[tr.TypeName(o.Type)]
+			types[o.Type] = match
+		}
+		if match {
+			rs = rs.Add(o.Addr, o.Addr+o.Size)
+		}
+		return nil
+	})
+	return rs, err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	elf2 "github.com/sitano/goelf/elf"
+	flag "github.com/spf13/pflag"
+)
+
+var stringsMinLen = flag.IntP("min-len", "n", 4, "strings: minimum string length in runes")
+var stringsMaxLen = flag.Int("max-len", 4096, "strings: maximum string length in bytes")
+
+func (p *Process) PrintStrings() error {
+	sym, err := p.Symbols()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading .symtab", err)
+	}
+
+	strs, err := elf2.ReadGoStrings(p.efd, sym, elf2.GoStringsOptions{
+		MinLen: *stringsMinLen,
+		MaxLen: *stringsMaxLen,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, s := range strs {
+		fmt.Printf("0x%x\t%d\t%s\t%s\n", s.Addr, len(s.Value), s.Source, strconv.Quote(s.Value))
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"debug/gosym"
+	"fmt"
+	"sort"
+
+	elf2 "github.com/sitano/goelf/elf"
+	"golang.org/x/debug/elf"
+)
+
+// GoSymTab returns the Go symbol table decoded from .gopclntab. It is
+// present in stripped binaries as well.
+func (p *Process) GoSymTab() (*gosym.Table, error) {
+	if p.gosym != nil {
+		return p.gosym, nil
+	}
+
+	s := p.efd.Section(".gopclntab")
+	if s == nil {
+		return nil, fmt.Errorf("no .gopclntab section")
+	}
+	data, err := elf2.SectionData(p.efd, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var text uint64
+	if t := p.efd.Section(".text"); t != nil {
+		text = t.Addr
+	}
+
+	if p.gosym, err = gosym.NewTable(nil, gosym.NewLineTable(data, text)); err != nil {
+		return nil, err
+	}
+
+	return p.gosym, nil
+}
+
+// funcSymbols returns .symtab function symbols sorted by address.
+func (p *Process) funcSymbols() []elf.Symbol {
+	if p.funcs != nil {
+		return p.funcs
+	}
+
+	sym, _ := p.Symbols()
+	p.funcs = []elf.Symbol{}
+	for _, s := range sym {
+		if elf.ST_TYPE(s.Info) == elf.STT_FUNC && s.Value != 0 {
+			p.funcs = append(p.funcs, s)
+		}
+	}
+	sort.Slice(p.funcs, func(i, j int) bool { return p.funcs[i].Value < p.funcs[j].Value })
+
+	return p.funcs
+}
+
+// objectSymbols returns .symtab data symbols sorted by address.
+func (p *Process) objectSymbols() []elf.Symbol {
+	if p.objs != nil {
+		return p.objs
+	}
+
+	sym, _ := p.Symbols()
+	p.objs = []elf.Symbol{}
+	for _, s := range sym {
+		if elf.ST_TYPE(s.Info) == elf.STT_OBJECT && s.Value != 0 {
+			p.objs = append(p.objs, s)
+		}
+	}
+	sort.Slice(p.objs, func(i, j int) bool { return p.objs[i].Value < p.objs[j].Value })
+
+	return p.objs
+}
+
+// LookupAddr returns the function or the data symbol containing addr.
+func (p *Process) LookupAddr(addr uint64) (string, uint64, bool) {
+	if name, entry, ok := p.LookupPC(addr); ok {
+		return name, entry, true
+	}
+
+	objs := p.objectSymbols()
+	i := sort.Search(len(objs), func(i int) bool { return objs[i].Value > addr }) - 1
+	if i >= 0 && addr < objs[i].Value+objs[i].Size {
+		return objs[i].Name, objs[i].Value, true
+	}
+
+	return "", 0, false
+}
+
+// LookupPC returns the function containing pc and the function entry
+// by pclntab or, for non Go code, by .symtab.
+func (p *Process) LookupPC(pc uint64) (string, uint64, bool) {
+	if tab, err := p.GoSymTab(); err == nil {
+		if fn := tab.PCToFunc(pc); fn != nil {
+			return fn.Name, fn.Entry, true
+		}
+	}
+
+	funcs := p.funcSymbols()
+	i := sort.Search(len(funcs), func(i int) bool { return funcs[i].Value > pc }) - 1
+	if i >= 0 {
+		s := funcs[i]
+		if pc < s.Value+s.Size || (s.Size == 0 && i+1 < len(funcs) && pc < funcs[i+1].Value) {
+			return s.Name, s.Value, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// Symbolize formats pc as symbol+offset.
+func (p *Process) Symbolize(pc uint64) string {
+	name, entry, ok := p.LookupPC(pc)
+	if !ok {
+		return fmt.Sprintf("0x%x", pc)
+	}
+	if pc == entry {
+		return name
+	}
+	return fmt.Sprintf("%s+0x%x", name, pc-entry)
+}
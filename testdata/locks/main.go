@@ -0,0 +1,49 @@
+// Command locks deadlocks on package-level mutexes locked in the opposite
+// order and crashes to leave a core for goelf core locks:
+//
+//	ulimit -c unlimited
+//	go build -o locks ./testdata/locks && ./locks
+//	goelf core locks -c ./core -f ./locks
+package main
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	mu  sync.Mutex
+	mu2 sync.Mutex
+)
+
+func ab(started *sync.WaitGroup) {
+	mu.Lock()
+	started.Done()
+	time.Sleep(10 * time.Millisecond)
+	mu2.Lock()
+	mu2.Unlock()
+	mu.Unlock()
+}
+
+func ba(started *sync.WaitGroup) {
+	mu2.Lock()
+	started.Done()
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	mu.Unlock()
+	mu2.Unlock()
+}
+
+func main() {
+	var started sync.WaitGroup
+	started.Add(2)
+	go ab(&started)
+	go ba(&started)
+	started.Wait()
+	time.Sleep(100 * time.Millisecond)
+
+	debug.SetTraceback("crash")
+	var p *int
+	*p = 1
+}
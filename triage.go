@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+)
+
+// TriageReport is what on-call needs to know first about a crash.
+type TriageReport struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+	Args string `json:"args"`
+
+	Signal *TriageSignal `json:"signal,omitempty"`
+	// Thread is the thread the kernel reports first, the one that got
+	// the signal.
+	Thread *TriageThread `json:"thread,omitempty"`
+	Panic  string        `json:"panic,omitempty"`
+
+	GoVersion  string `json:"go_version,omitempty"`
+	MainModule string `json:"main_module,omitempty"`
+
+	Goroutines int            `json:"goroutines"`
+	States     map[string]int `json:"states"`
+	Stacks     []*StackBucket `json:"stacks"`
+	// Threads are the stacks of the other threads, unwound by pclntab
+	// when the goroutines could not be read.
+	Threads []*TriageThread `json:"threads,omitempty"`
+
+	Memory *elf2.RuntimeStats `json:"memory,omitempty"`
+
+	// Errors are the parts of the report that could not be read.
+	Errors []string `json:"errors,omitempty"`
+}
+
+type TriageSignal struct {
+	Signo int    `json:"signo"`
+	Name  string `json:"name"`
+	Code  int    `json:"code"`
+	// Addr is the faulting address of SIGSEGV, SIGBUS, SIGILL, SIGFPE
+	// and SIGTRAP.
+	Addr uint64 `json:"addr,omitempty"`
+}
+
+type TriageThread struct {
+	Tid       uint64       `json:"tid"`
+	Goroutine uint64       `json:"goroutine,omitempty"`
+	Frames    []StackFrame `json:"frames"`
+}
+
+// Triage prints the summary of the crash of the core.
+func (p *Process) Triage() error {
+	if p.core == nil {
+		return fmt.Errorf("triage needs a core")
+	}
+	o, c := p.core.ByteOrder, p.core.Class
+	rep := &TriageReport{States: map[string]int{}}
+	fail := func(what string, err error) {
+		rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	notes, err := elf2.ReadAllNotes(p.core)
+	if err != nil {
+		return err
+	}
+	for _, n := range notes {
+		if n.Name != "CORE" {
+			continue
+		}
+		switch n.Type {
+		case elf2.NT_PRPSINFO:
+			prps, err := elf2.ReadPRPSInfo(n, o, c)
+			if err != nil {
+				fail("NT_PRPSINFO", err)
+				continue
+			}
+			rep.PID, rep.Name, rep.Args = int(prps.PID), prps.FName, strings.TrimSpace(prps.PSArgs)
+		case elf2.NT_SIGINFO:
+			si, err := elf2.ReadSigInfo(n, o, c)
+			if err != nil {
+				fail("NT_SIGINFO", err)
+				continue
+			}
+			if si.Signo == 0 {
+				continue
+			}
+			rep.Signal = &TriageSignal{Signo: int(si.Signo), Name: elf2.Signal(si.Signo).String(), Code: int(si.Code)}
+			if elf2.Signal(si.Signo).Fault() {
+				rep.Signal.Addr = si.Addr
+			}
+		}
+	}
+
+	if bi, err := elf2.ReadBuildInfo(p.efd, p.Memory()); err == nil {
+		rep.GoVersion = bi.GoVersion
+		rep.MainModule = strings.TrimSpace(bi.Main.Path + " " + bi.Main.Version)
+	} else {
+		fail("build info", err)
+	}
+
+	threads, err := p.Threads()
+	if err != nil {
+		fail("threads", err)
+	}
+	u, err := p.Unwinder()
+	if err != nil {
+		fail("unwinder", err)
+	}
+	var stacks []*TriageThread
+	if u != nil {
+		stacks = p.ThreadStacks(u, threads)
+	}
+	if len(stacks) > 0 {
+		rep.Thread = stacks[0]
+	}
+
+	gs, err := p.Goroutines()
+	if err != nil {
+		fail("goroutines", err)
+		if len(stacks) > 1 {
+			rep.Threads = stacks[1:]
+		}
+	}
+	var panicking *elf2.Goroutine
+	for _, g := range gs {
+		if rep.Thread != nil && g.Thread == rep.Thread.Tid {
+			rep.Thread.Goroutine = g.ID
+			if g.Panic != 0 {
+				panicking = g
+			}
+		}
+		if panicking == nil && g.Panic != 0 {
+			panicking = g
+		}
+	}
+	if panicking != nil {
+		if rep.Panic, err = p.panicValue(panicking); err != nil {
+			fail("panic", err)
+		}
+	}
+	rep.Goroutines = len(gs)
+	for _, g := range gs {
+		rep.States[goroutineState(g)]++
+	}
+
+	if d, err := p.DWARF(); err == nil && u != nil {
+		rep.Stacks = p.BucketGoroutines(gs, elf2.Nanotime(u.R, d, gs), !*ignoreLines, !*ignoreArgs)
+		if rep.Memory, err = elf2.ReadRuntimeStats(u.R, d); err != nil {
+			fail("runtime stats", err)
+		}
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	p.printTriage(rep)
+	return nil
+}
+
+// ThreadStacks unwinds the threads from their registers by pclntab only.
+func (p *Process) ThreadStacks(u *elf2.Unwinder, threads []elf2.Thread) []*TriageThread {
+	var ts []*TriageThread
+	for _, t := range threads {
+		frames, _ := u.Unwind(t.PC, t.SP)
+		ts = append(ts, &TriageThread{Tid: t.Tid, Frames: p.StackFrames(frames)})
+	}
+	return ts
+}
+
+// panicValue formats the value of the innermost panic of the goroutine.
+func (p *Process) panicValue(g *elf2.Goroutine) (string, error) {
+	d, err := p.DWARF()
+	if err != nil {
+		return "", err
+	}
+	vp, err := p.ValuePrinter()
+	if err != nil {
+		return "", err
+	}
+	e, err := d.LookupEntry("runtime._panic")
+	if err != nil {
+		return "", err
+	}
+	t, err := d.Type(e.Offset)
+	if err != nil {
+		return "", err
+	}
+	arg, err := elf2.NewValue(vp.Reader(), g.Panic, t).Field("arg")
+	if err != nil {
+		return "", err
+	}
+	return vp.Format(arg.Addr, arg.Type), nil
+}
+
+func (p *Process) printTriage(rep *TriageReport) {
+	fmt.Printf("Process:    %d %s\n", rep.PID, rep.Name)
+	fmt.Printf("Command:    %s\n", rep.Args)
+	if rep.Signal != nil {
+		fmt.Printf("Signal:     %s (%d) code %d", rep.Signal.Name, rep.Signal.Signo, rep.Signal.Code)
+		if rep.Signal.Addr != 0 {
+			fmt.Printf(" addr 0x%x", rep.Signal.Addr)
+		}
+		fmt.Println()
+	} else {
+		fmt.Printf("Signal:     none\n")
+	}
+	if rep.Panic != "" {
+		fmt.Printf("Panic:      %s\n", rep.Panic)
+	}
+	fmt.Printf("Go:         %s\n", rep.GoVersion)
+	fmt.Printf("Module:     %s\n", rep.MainModule)
+	if m := rep.Memory; m != nil {
+		fmt.Printf("Memory:     heap in use %s, live %s, goal %s, stacks %s, %d GCs\n",
+			byteSize(m.HeapInUse), byteSize(m.HeapLive), byteSize(m.HeapGoal), byteSize(m.StacksInUse), m.NumGC)
+	}
+
+	var states []string
+	for s, n := range rep.States {
+		states = append(states, fmt.Sprintf("%s=%d", s, n))
+	}
+	sort.Strings(states)
+	if rep.Goroutines > 0 {
+		fmt.Printf("Goroutines: %d %s\n", rep.Goroutines, strings.Join(states, " "))
+	} else {
+		fmt.Printf("Goroutines: unknown\n")
+	}
+
+	if rep.Thread != nil {
+		printThreads([]*TriageThread{rep.Thread})
+	}
+	printThreads(rep.Threads)
+
+	printBuckets(rep.Stacks)
+
+	for _, e := range rep.Errors {
+		fmt.Fprintln(os.Stderr, "Error:", e)
+	}
+}
+
+func printThreads(ts []*TriageThread) {
+	for _, t := range ts {
+		fmt.Printf("\nThread %d", t.Tid)
+		if t.Goroutine != 0 {
+			fmt.Printf(" (goroutine %d)", t.Goroutine)
+		}
+		fmt.Println(":")
+		printFrames(t.Frames)
+	}
+}
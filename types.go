@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	elf2 "github.com/sitano/goelf/elf"
+)
+
+// TypeReader returns the decoder of runtime type descriptors of the
+// first module.
+func (p *Process) TypeReader() (*elf2.TypeReader, error) {
+	if p.types != nil {
+		return p.types, nil
+	}
+
+	md, err := p.ModuleData()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := elf2.NewMemReader(p.Memory(), p.efd.ByteOrder, p.efd.Class)
+	if err != nil {
+		return nil, err
+	}
+
+	p.types = elf2.NewTypeReader(r, md)
+	return p.types, nil
+}
+
+// ModuleData returns decoded runtime.firstmoduledata.
+func (p *Process) ModuleData() (*elf2.ModuleData, error) {
+	if p.md != nil {
+		return p.md, nil
+	}
+
+	// stripped binaries are scanned for moduledata instead
+	sym, _ := p.Symbols()
+
+	var err error
+	if p.md, err = elf2.FindModuleData(p.efd, p.Memory(), sym); err != nil {
+		return nil, err
+	}
+
+	return p.md, nil
+}
+
+func (p *Process) PrintTypes() {
+	tr, err := p.TypeReader()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading moduledata:", err)
+		return
+	}
+
+	types, err := tr.AllTypes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading types:", err)
+	}
+	elf2.SortTypes(types)
+
+	for _, t := range types {
+		fmt.Printf("0x%x %v %s size=%d", t.Addr, t.Kind, t.Name, t.Size)
+		if t.PkgPath != "" {
+			fmt.Printf(" pkg=%s", t.PkgPath)
+		}
+		fmt.Println()
+		for _, d := range typeDetails(tr, t) {
+			fmt.Printf("\t%s\n", d)
+		}
+	}
+	fmt.Println()
+}
+
+func typeDetails(tr *elf2.TypeReader, t *elf2.GoType) []string {
+	var d []string
+
+	switch t.Kind {
+	case reflect.Array:
+		d = append(d, fmt.Sprintf("[%d]%s", t.Len, tr.TypeName(t.Elem)))
+	case reflect.Chan:
+		d = append(d, fmt.Sprintf("%v %s", t.ChanDir, tr.TypeName(t.Elem)))
+	case reflect.Map:
+		d = append(d, fmt.Sprintf("map[%s]%s", tr.TypeName(t.Key), tr.TypeName(t.Elem)))
+	case reflect.Ptr, reflect.Slice:
+		d = append(d, "elem "+tr.TypeName(t.Elem))
+	case reflect.Func:
+		var in, out []string
+		for _, x := range t.In {
+			in = append(in, tr.TypeName(x))
+		}
+		for _, x := range t.Out {
+			out = append(out, tr.TypeName(x))
+		}
+		if t.Variadic && len(in) > 0 {
+			in[len(in)-1] = "..." + strings.TrimPrefix(in[len(in)-1], "[]")
+		}
+		d = append(d, fmt.Sprintf("func(%s) (%s)", strings.Join(in, ", "), strings.Join(out, ", ")))
+	case reflect.Struct:
+		for _, f := range t.Fields {
+			s := fmt.Sprintf("+%d %s %s", f.Offset, f.Name, tr.TypeName(f.Type))
+			if f.Embedded {
+				s += " (embedded)"
+			}
+			if f.Tag != "" {
+				s += " `" + f.Tag + "`"
+			}
+			d = append(d, s)
+		}
+	case reflect.Interface:
+		for _, m := range t.IMethods {
+			d = append(d, fmt.Sprintf("%s %s", m.Name, tr.TypeName(m.Type)))
+		}
+	}
+
+	for _, m := range t.Methods {
+		s := "method " + m.Name
+		if m.Type != 0 {
+			s += " " + tr.TypeName(m.Type)
+		}
+		if m.IFn != 0 || m.TFn != 0 {
+			s += fmt.Sprintf(" ifn=0x%x tfn=0x%x", m.IFn, m.TFn)
+		}
+		d = append(d, s)
+	}
+
+	return d
+}
+
+func (p *Process) PrintModuleData() {
+	md, err := p.ModuleData()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading moduledata:", err)
+		return
+	}
+
+	PrintStruct(*md, 1)
+	fmt.Println()
+}